@@ -17,10 +17,15 @@ import (
 )
 
 var defs = map[string]string{
-	"cacheFile": "/tmp/tmp.battery_notify_timestamp",
-	"threshold": "15",
-	"delay":     "20m",
-	"playSound": "true",
+	"cacheFile":       "/tmp/tmp.battery_notify_timestamp",
+	"threshold":       "15",
+	"delay":           "20m",
+	"playSound":       "true",
+	"backend":         "sysfs",
+	"upowerBus":       "system",
+	"powerSupplyRoot": "/sys/class/power_supply",
+	"battery":         "combined",
+	"stateFile":       "/tmp/tmp.battery_notify_samples",
 }
 var defKeys = util.Keys(defs)
 
@@ -87,7 +92,13 @@ func batteryNotify(c cfg) error {
 	ts := time.Now().Unix()
 
 	if ts-prev_ts >= int64(c.delay.Seconds()) {
-		info, err := util.GetBatteryInfo()
+		info, err := util.GetBatteryInfo(util.BatteryOptions{
+			Backend:         c.backend,
+			UPowerBus:       c.upowerBus,
+			PowerSupplyRoot: c.powerSupplyRoot,
+			Battery:         c.battery,
+			StateFile:       c.stateFile,
+		})
 		if err != nil {
 			return e.Wrap(err, "get battery info")
 		}
@@ -97,10 +108,12 @@ func batteryNotify(c cfg) error {
 				return e.Wrap(err, "get battery image file")
 			}
 			defer os.RemoveAll(batteryImageFile.Name())
+			message := fmt.Sprintf("Battery is at %d%%", info.Level)
+			if remaining := util.FormatRemaining(info.Remaining); remaining != "" {
+				message += fmt.Sprintf(", ~%s left", remaining)
+			}
 			err = util.Notify(
-				fmt.Sprintf(
-					"Battery is at %d%%", info.Level,
-				),
+				message,
 				util.Critical,
 				0,
 				batteryImageFile.Name(),
@@ -128,10 +141,15 @@ func batteryNotify(c cfg) error {
 }
 
 type cfg struct {
-	cacheFile string
-	delay     time.Duration
-	threshold int
-	playSound bool
+	cacheFile       string
+	delay           time.Duration
+	threshold       int
+	playSound       bool
+	backend         string
+	upowerBus       string
+	powerSupplyRoot string
+	battery         string
+	stateFile       string
 }
 
 type Server struct {
@@ -155,11 +173,36 @@ func getConfig(x *Z.Cmd) (cfg, error) {
 	if err != nil {
 		return cfg{}, err
 	}
+	backend, err := util.Get[string](x, `backend`)
+	if err != nil {
+		return cfg{}, err
+	}
+	upowerBus, err := util.Get[string](x, `upowerBus`)
+	if err != nil {
+		return cfg{}, err
+	}
+	powerSupplyRoot, err := util.Get[string](x, `powerSupplyRoot`)
+	if err != nil {
+		return cfg{}, err
+	}
+	battery, err := util.Get[string](x, `battery`)
+	if err != nil {
+		return cfg{}, err
+	}
+	stateFile, err := util.Get[string](x, `stateFile`)
+	if err != nil {
+		return cfg{}, err
+	}
 	return cfg{
-		cacheFile: cacheFile,
-		threshold: threshold,
-		delay:     delay,
-		playSound: playSound,
+		cacheFile:       cacheFile,
+		threshold:       threshold,
+		delay:           delay,
+		playSound:       playSound,
+		backend:         backend,
+		upowerBus:       upowerBus,
+		powerSupplyRoot: powerSupplyRoot,
+		battery:         battery,
+		stateFile:       stateFile,
 	}, nil
 }
 
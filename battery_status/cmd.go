@@ -18,8 +18,16 @@ var defs = map[string]string{
 	"charging":              `{"20": " ", "40": " ", "60": " ", "80": " ", "100": " "}`,
 	"discharging":           `{"20": " ", "40": " ", "60": " ", "80": " ", "100": " "}`,
 	"notCharging":           `{"100": ""}`,
+	"full":                  `{"100": ""}`,
+	"unknown":               `{"100": ""}`,
+	"ac":                    "",
 	"format":                "{status} {level}%",
 	"chargingFrameDuration": "1s",
+	"backend":               "sysfs",
+	"upowerBus":             "system",
+	"powerSupplyRoot":       "/sys/class/power_supply",
+	"battery":               "combined",
+	"stateFile":             "/tmp/tmp.battery_status_samples",
 }
 var defKeys = util.Keys(defs)
 
@@ -29,19 +37,31 @@ func init() {
 }
 
 func outputBatteryStatus(c cfg) error {
-	info, err := util.GetBatteryInfo()
+	info, err := util.GetBatteryInfo(util.BatteryOptions{
+		Backend:         c.backend,
+		UPowerBus:       c.upowerBus,
+		PowerSupplyRoot: c.powerSupplyRoot,
+		Battery:         c.battery,
+		StateFile:       c.stateFile,
+	})
 	if err != nil {
-		e.Wrap(err, "get battery info")
+		return e.Wrap(err, "get battery info")
 	}
 	var levelMap map[int]string
-	if info.Status == util.Discharging {
+	switch info.Status {
+	case util.Discharging:
 		levelMap = c.discharging
-	} else if info.Status == util.Charging {
+	case util.Charging:
 		levelMap = c.charging
-	} else if info.Status == util.NotCharging {
+	case util.NotCharging:
 		levelMap = c.notCharging
-	} else {
-		return e.New("unknown status")
+	case util.Full:
+		levelMap = c.full
+	default:
+		levelMap = c.unknown
+	}
+	if len(levelMap) == 0 {
+		return e.New("no symbols configured for the battery status")
 	}
 	thresholds := util.Keys(levelMap)
 	sort.Ints(thresholds)
@@ -67,9 +87,15 @@ func outputBatteryStatus(c cfg) error {
 	} else {
 		statusSymbol = levelMap[thresholds[thresholdIndex]]
 	}
+	var acSymbol string
+	if info.ACOnline {
+		acSymbol = c.ac
+	}
 	args := map[string]interface{}{
-		"status": statusSymbol,
-		"level":  info.Level,
+		"status":    statusSymbol,
+		"level":     info.Level,
+		"ac":        acSymbol,
+		"remaining": util.FormatRemaining(info.Remaining),
 	}
 	_, err = fmt.Print(util.Fprint(c.format, args))
 	if err != nil {
@@ -82,8 +108,16 @@ type cfg struct {
 	charging              map[int]string
 	discharging           map[int]string
 	notCharging           map[int]string
+	full                  map[int]string
+	unknown               map[int]string
+	ac                    string
 	format                string
 	chargingFrameDuration time.Duration
+	backend               string
+	upowerBus             string
+	powerSupplyRoot       string
+	battery               string
+	stateFile             string
 }
 
 func getConfig(x *Z.Cmd) (cfg, error) {
@@ -99,6 +133,18 @@ func getConfig(x *Z.Cmd) (cfg, error) {
 	if err != nil {
 		return cfg{}, err
 	}
+	full, err := util.Get[map[int]string](x, "full")
+	if err != nil {
+		return cfg{}, err
+	}
+	unknown, err := util.Get[map[int]string](x, "unknown")
+	if err != nil {
+		return cfg{}, err
+	}
+	ac, err := util.Get[string](x, "ac")
+	if err != nil {
+		return cfg{}, err
+	}
 	format, err := util.Get[string](x, "format")
 	if err != nil {
 		return cfg{}, err
@@ -107,12 +153,40 @@ func getConfig(x *Z.Cmd) (cfg, error) {
 	if err != nil {
 		return cfg{}, err
 	}
+	backend, err := util.Get[string](x, "backend")
+	if err != nil {
+		return cfg{}, err
+	}
+	upowerBus, err := util.Get[string](x, "upowerBus")
+	if err != nil {
+		return cfg{}, err
+	}
+	powerSupplyRoot, err := util.Get[string](x, "powerSupplyRoot")
+	if err != nil {
+		return cfg{}, err
+	}
+	battery, err := util.Get[string](x, "battery")
+	if err != nil {
+		return cfg{}, err
+	}
+	stateFile, err := util.Get[string](x, "stateFile")
+	if err != nil {
+		return cfg{}, err
+	}
 	return cfg{
 		charging:              charging,
 		discharging:           discharging,
 		notCharging:           notCharging,
+		full:                  full,
+		unknown:               unknown,
+		ac:                    ac,
 		format:                format,
 		chargingFrameDuration: chargingFrameDuration,
+		backend:               backend,
+		upowerBus:             upowerBus,
+		powerSupplyRoot:       powerSupplyRoot,
+		battery:               battery,
+		stateFile:             stateFile,
 	}, nil
 }
 
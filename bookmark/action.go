@@ -0,0 +1,157 @@
+package bookmark
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/magnickolas/x/util"
+	e "github.com/pkg/errors"
+	"golang.design/x/clipboard"
+	"golang.org/x/term"
+)
+
+// actions are what can be done with a picked bookmark.
+var actions = []string{"copy", "type", "open", "exec"}
+
+// copyBookmark copies the content to the clipboard, printing the shown
+// line if there is a terminal. The previous clipboard content is
+// restored as 'restoreClipboard' says, or after clearAfter (for secrets)
+// if that is set and sooner. Without a display, e.g. over SSH, there is
+// no clipboard and the content is printed instead.
+func copyBookmark(content string, shown string, clearAfter time.Duration, c cfg) error {
+	// macOS has a clipboard without X11 or Wayland
+	if !hasDisplay() && runtime.GOOS != "darwin" {
+		fmt.Println(content)
+		return nil
+	}
+	err := clipboard.Init()
+	if err != nil {
+		return e.Wrap(err, "init clipboard")
+	}
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Println(shown)
+	}
+	if c.typeKeys {
+		err := typeKeys(content)
+		if err != nil {
+			return e.Wrap(err, "type keys")
+		}
+	}
+	restoreAfter := c.restoreAfter
+	if clearAfter > 0 && (restoreAfter == 0 || clearAfter < restoreAfter) {
+		restoreAfter = clearAfter
+	}
+	restore := restoreAfter > 0 || c.restoreOnPaste
+	var previous, previousPrimary []byte
+	if restore {
+		previous = clipboard.Read(clipboard.FmtText)
+	}
+	if c.writePrimarySelection {
+		if restore {
+			previousPrimary, err = readPrimarySelection()
+			if err != nil {
+				return err
+			}
+		}
+		err = writePrimarySelection([]byte(content))
+		if err != nil {
+			return err
+		}
+	}
+	if c.restoreOnPaste && restoreAfter == 0 {
+		err = serveOnePaste([]byte(content))
+		if err != nil {
+			return err
+		}
+	} else {
+		done := clipboard.Write(clipboard.FmtText, []byte(content))
+		if !restore {
+			<-done
+			return nil
+		}
+		timeout := time.After(restoreAfter)
+		select {
+		case <-done:
+			// the clipboard was taken over, there is nothing to restore
+			// but the primary selection, which may still hold a secret
+			if !c.writePrimarySelection {
+				return nil
+			}
+			<-timeout
+			return writePrimarySelection(previousPrimary)
+		case <-timeout:
+		}
+	}
+	if c.writePrimarySelection {
+		err = writePrimarySelection(previousPrimary)
+		if err != nil {
+			return err
+		}
+	}
+	if len(previous) == 0 {
+		clipboard.Write(clipboard.FmtText, nil)
+		return nil
+	}
+	<-clipboard.Write(clipboard.FmtText, previous)
+	return nil
+}
+
+// localPath returns the path of an existing file the content refers to,
+// either as a path (~ is expanded) or as a file:// URL.
+func localPath(content string) (string, bool) {
+	path := content
+	if u, err := url.Parse(content); err == nil && u.Scheme == "file" {
+		path = u.Path
+	} else if strings.HasPrefix(path, "~/") {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", false
+		}
+		path = filepath.Join(home, path[2:])
+	}
+	if !filepath.IsAbs(path) && !strings.HasPrefix(path, ".") {
+		return "", false
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+// openBookmark opens files in the editor and URLs with the browser
+// command, which is not waited for.
+func openBookmark(content string, c cfg) error {
+	if path, ok := localPath(content); ok {
+		editorPath, err := util.FindEditor(c.editor)
+		if err != nil {
+			return err
+		}
+		return e.Wrap(util.EditFile(path, editorPath), "edit file")
+	}
+	if u, err := url.Parse(content); err != nil || u.Scheme == "" {
+		return e.Errorf("%q is neither a URL nor an existing file", content)
+	}
+	if len(c.browserCmd) == 0 {
+		return e.New("browserCmd is empty")
+	}
+	cmd := exec.Command(c.browserCmd[0], append(c.browserCmd[1:], content)...)
+	err := cmd.Start()
+	if err != nil {
+		return e.Wrapf(err, "run %s", c.browserCmd[0])
+	}
+	return cmd.Process.Release()
+}
+
+func execBookmark(content string) error {
+	cmd := exec.Command("sh", "-c", content)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
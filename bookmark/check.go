@@ -0,0 +1,169 @@
+package bookmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// deadTag is attached to broken bookmarks by `check --mark`.
+const deadTag = "dead"
+
+// linkStatus is the outcome of checking a URL bookmark; status is 0 when
+// the URL could not be reached at all.
+type linkStatus struct {
+	Index   int    `json:"index"`
+	Content string `json:"content"`
+	Status  int    `json:"status,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (s linkStatus) broken() bool {
+	return s.Status == 0 || s.Status >= 400
+}
+
+// checkLink issues a HEAD request, falling back to GET for servers that
+// do not support HEAD.
+func checkLink(client *http.Client, link string) (int, error) {
+	status, err := request(client, http.MethodHead, link)
+	if err == nil && status != http.StatusMethodNotAllowed &&
+		status != http.StatusNotImplemented && status != http.StatusForbidden {
+		return status, nil
+	}
+	return request(client, http.MethodGet, link)
+}
+
+func request(client *http.Client, method string, link string) (int, error) {
+	req, err := http.NewRequest(method, link, nil)
+	if err != nil {
+		return 0, e.Wrap(err, "create request")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	return resp.StatusCode, nil
+}
+
+// checkLinks checks every URL bookmark using at most parallel requests
+// at a time and returns the broken ones in file order.
+func checkLinks(bookmarks []bookmark, parallel int, timeout time.Duration) []linkStatus {
+	client := &http.Client{Timeout: timeout}
+	jobs := make(chan indexedBookmark)
+	results := make(chan linkStatus)
+	var wg sync.WaitGroup
+	for i := 0; i < parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ib := range jobs {
+				s := linkStatus{Index: ib.index, Content: ib.b.content}
+				status, err := checkLink(client, ib.b.content)
+				s.Status = status
+				if err != nil {
+					s.Error = err.Error()
+				}
+				results <- s
+			}
+		}()
+	}
+	go func() {
+		for _, ib := range indexBookmarks(bookmarks) {
+			if isWebURL(ib.b.content) {
+				jobs <- ib
+			}
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+	var broken []linkStatus
+	for s := range results {
+		if s.broken() {
+			broken = append(broken, s)
+		}
+	}
+	slices.SortFunc(broken, func(a, b linkStatus) bool {
+		return a.Index < b.Index
+	})
+	return broken
+}
+
+func printLinkStatuses(w io.Writer, statuses []linkStatus, asJSON bool) error {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if statuses == nil {
+			statuses = []linkStatus{}
+		}
+		return e.Wrap(enc.Encode(statuses), "encode link statuses")
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "INDEX\tSTATUS\tURL")
+	for _, s := range statuses {
+		status := fmt.Sprint(s.Status)
+		if s.Status == 0 {
+			status = "unreachable"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Index, status, s.Content)
+	}
+	return e.Wrap(tw.Flush(), "print link statuses")
+}
+
+// checkAction is what `check` does with broken bookmarks besides
+// reporting them.
+type checkAction int
+
+const (
+	checkReport checkAction = iota
+	checkMark
+	checkRemove
+)
+
+func checkBookmarkFile(bookmarkFile string, parallel int, timeout time.Duration, action checkAction, asJSON bool) error {
+	if parallel < 1 {
+		return e.Errorf("invalid parallelism %d", parallel)
+	}
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return e.Wrap(err, "read bookmarks")
+	}
+	broken := checkLinks(bookmarks, parallel, timeout)
+	err = printLinkStatuses(os.Stdout, broken, asJSON)
+	if err != nil {
+		return err
+	}
+	if action == checkReport || len(broken) == 0 {
+		return nil
+	}
+	dead := map[string]bool{}
+	for _, s := range broken {
+		dead[s.Content] = true
+	}
+	// the file may have changed while checking, so the broken bookmarks
+	// are looked up by content rather than by index
+	return updateBookmarks(bookmarkFile, func(bookmarks []bookmark) ([]bookmark, error) {
+		var kept []bookmark
+		for _, b := range bookmarks {
+			switch {
+			case !dead[b.content]:
+			case action == checkRemove:
+				continue
+			case !slices.Contains(b.tags, deadTag):
+				b.tags = append(b.tags, deadTag)
+			}
+			kept = append(kept, b)
+		}
+		return kept, nil
+	})
+}
@@ -0,0 +1,76 @@
+package bookmark
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCheckLinks(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/nohead", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// a port nothing listens on anymore
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "http://" + l.Addr().String() + "/"
+	l.Close()
+
+	bookmarks := []bookmark{
+		{content: srv.URL + "/ok"},
+		{content: "not a link"},
+		{content: srv.URL + "/nohead"},
+		{content: srv.URL + "/missing"},
+		{content: unreachable},
+	}
+	broken := checkLinks(bookmarks, 2, time.Second)
+	if len(broken) != 2 {
+		t.Fatalf("checkLinks() = %+v, want 2 broken links", broken)
+	}
+	if broken[0].Index != 4 || broken[0].Status != http.StatusNotFound {
+		t.Errorf("broken[0] = %+v, want index 4 with status 404", broken[0])
+	}
+	if broken[1].Index != 5 || broken[1].Status != 0 || broken[1].Error == "" {
+		t.Errorf("broken[1] = %+v, want index 5 unreachable", broken[1])
+	}
+}
+
+func TestCheckLinksParallelism(t *testing.T) {
+	const parallel = 3
+	var inFlight, maxInFlight int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}))
+	defer srv.Close()
+
+	var bookmarks []bookmark
+	for i := 0; i < 12; i++ {
+		bookmarks = append(bookmarks, bookmark{content: srv.URL + "/" + string(rune('a'+i))})
+	}
+	if broken := checkLinks(bookmarks, parallel, time.Second); len(broken) != 0 {
+		t.Errorf("checkLinks() = %+v, want no broken links", broken)
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > parallel {
+		t.Errorf("%d requests in flight, want at most %d", max, parallel)
+	}
+}
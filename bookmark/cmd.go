@@ -2,15 +2,25 @@ package bookmark
 
 import (
 	"bytes"
+	"crypto/sha1"
 	_ "embed"
+	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/url"
 	"os"
 	"os/exec"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/magnickolas/x/util"
 	"github.com/ncruces/zenity"
@@ -20,19 +30,35 @@ import (
 	"github.com/rwxrob/help"
 	"github.com/rwxrob/vars"
 	"golang.design/x/clipboard"
-	"golang.org/x/term"
+	"golang.org/x/exp/slices"
 )
 
 var defs = map[string]string{
-	"askForDescription":    "true",
-	"bookmarkFile":         Z.Dynamic[`homedir`].(func(...string) string)(".bookmarks"),
-	"pickerCmd":            `["rofi", "-dmenu", "-i", "-p", "Choose bookmark"]`,
-	"notify":               "true",
-	"notifyDuration":       "3s",
-	"typeKeys":             "false",
-	"unixPrimarySelection": "false",
-	"editor":               "",
-	"sort":                 "-date",
+	"askForDescription":     "true",
+	"autoTitle":             "false",
+	"titleTimeout":          "3s",
+	"bookmarkFile":          Z.Dynamic[`homedir`].(func(...string) string)(".bookmarks"),
+	"pickerCmd":             `["rofi", "-dmenu", "-i", "-format", "i", "-p", "Choose bookmark"]`,
+	"pickerOutput":          "index",
+	"notify":                "true",
+	"notifyDuration":        "3s",
+	"typeKeys":              "false",
+	"unixPrimarySelection":  "false",
+	"editor":                "",
+	"sort":                  "-date",
+	"collections":           `{}`,
+	"checkParallel":         "8",
+	"checkTimeout":          "10s",
+	"images":                "false",
+	"gitSync":               "false",
+	"secretCmd":             `[]`,
+	"secretClearAfter":      "30s",
+	"restoreClipboard":      "",
+	"writePrimarySelection": "false",
+	"serveAddr":             "127.0.0.1:7373",
+	"serveToken":            "",
+	"action":                "copy",
+	"browserCmd":            `["xdg-open"]`,
 }
 var defKeys = util.Keys(defs)
 
@@ -41,101 +67,530 @@ func init() {
 	util.Must(Z.Vars.SoftInit())
 }
 
-func prompt(content string) (string, error) {
+func prompt(content string, defaultText string) (string, error) {
 	return zenity.Entry(
 		fmt.Sprintf("Description of `%s`", content),
 		zenity.Title("Bookmark description"),
+		zenity.EntryText(defaultText),
 		zenity.Width(300),
 	)
 }
 
-func getBookmarkContent(unixPrimarySelection bool) (string, error) {
+// getBookmarkContent returns the selected text or, if there is none and
+// images are enabled, the image in the clipboard.
+func getBookmarkContent(unixPrimarySelection bool, images bool) (string, []byte, error) {
 	var text []byte
 	if unixPrimarySelection {
 		var err error
 		text, err = exec.Command("xsel", "-o").Output()
 		if err != nil {
-			return "", e.Wrap(err, "run xsel to get primary selection")
+			return "", nil, e.Wrap(err, "run xsel to get primary selection")
 		}
 	} else {
 		err := clipboard.Init()
 		if err != nil {
-			return "", e.Wrap(err, "init clipboard")
+			return "", nil, e.Wrap(err, "init clipboard")
 		}
 		text = clipboard.Read(clipboard.FmtText)
+		if len(bytes.TrimSpace(text)) == 0 && images {
+			return "", clipboard.Read(clipboard.FmtImage), nil
+		}
+	}
+	return trimContent(string(text)), nil, nil
+}
+
+// trimContent trims surrounding whitespace and blank lines, except for
+// the indentation of the first line of multi-line content.
+func trimContent(text string) string {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	for {
+		i := strings.IndexByte(text, '\n')
+		if i == -1 || strings.TrimSpace(text[:i]) != "" {
+			break
+		}
+		text = text[i+1:]
+	}
+	if !strings.ContainsAny(text, "\r\n") {
+		return strings.TrimSpace(text)
 	}
-	return string(bytes.TrimSpace(text)), nil
+	return text
 }
 
 type bookmark struct {
+	// id identifies the bookmark even if its content is edited
+	id          string
 	content     string
 	description string
+	tags        []string
+	added       time.Time
+	used        time.Time
+	uses        int
+	// image bookmarks are clipboard images stored in imageDir, their
+	// content is the file name
+	image bool
+	// secret bookmarks have their content encrypted, see encryptSecret
+	secret bool
+	// action overrides the 'action' variable for this bookmark
+	action string
+	// collection the bookmark was read from when picking across all of
+	// them, not stored in the file
+	collection string
+	// extraMeta are the metadata fields of unknown keys, written back as
+	// they were read
+	extraMeta []string
+}
+
+// metaSep separates the optional metadata fields (space separated
+// key=value pairs) from the rest of a bookmark line. They always include
+// the id, which tells them from a plain description containing " #| ".
+const metaSep = " #| "
+
+// metaKeys are the metadata keys bookmark knows about.
+var metaKeys = []string{"id", "enc", "kind", "tags", "added", "used", "uses", "action"}
+
+// contentHashRe and contentEscapedRe match "#" preceded by a space and
+// any backslashes, which would otherwise be taken for the start of the
+// description; one more backslash is added to escape them.
+var (
+	contentHashRe    = regexp.MustCompile(`( \\*)#`)
+	contentEscapedRe = regexp.MustCompile(`( \\*)\\#`)
+)
+
+func escapeContent(content string) string {
+	return contentHashRe.ReplaceAllString(content, `$1\#`)
+}
+
+func unescapeContent(content string) string {
+	return contentEscapedRe.ReplaceAllString(content, `$1#`)
+}
+
+// needsQuoting reports whether the content cannot be stored as is in a
+// bookmark line: it spans several lines, has surrounding whitespace or
+// is not printable text.
+func needsQuoting(content string) bool {
+	return content != strings.TrimSpace(content) || !utf8.ValidString(content) ||
+		strings.IndexFunc(content, func(r rune) bool {
+			return unicode.IsControl(r) && r != '\t'
+		}) != -1
+}
+
+// singleLine folds the line breaks and other control characters of a
+// description into spaces, so that it cannot end the bookmark line.
+func singleLine(text string) string {
+	if strings.IndexFunc(text, unicode.IsControl) == -1 {
+		return text
+	}
+	return strings.Join(strings.FieldsFunc(text, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+}
+
+// contentID is the ID given to a bookmark that does not have one yet.
+func contentID(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:4])
 }
 
 func (b bookmark) serialize() string {
-	line := b.content
-	if b.description != "" {
-		line += " # " + b.description
+	content := b.content
+	if needsQuoting(content) {
+		content = strconv.Quote(content)
+	}
+	line := escapeContent(content)
+	if description := singleLine(b.description); description != "" {
+		line += " # " + description
+	}
+	if meta := b.meta(); len(meta) > 0 {
+		line += metaSep + strings.Join(meta, " ")
 	}
 	return line
 }
 
 func (b *bookmark) deserialize(line string) {
+	var meta map[string]string
+	if i := strings.LastIndex(line, metaSep); i != -1 {
+		var ok bool
+		if meta, ok = parseMeta(line[i+len(metaSep):]); ok && meta["id"] != "" {
+			b.setMeta(meta)
+			for _, field := range strings.Fields(line[i+len(metaSep):]) {
+				if key, _, _ := strings.Cut(field, "="); !slices.Contains(metaKeys, key) {
+					b.extraMeta = append(b.extraMeta, field)
+				}
+			}
+			line = line[:i]
+		} else {
+			meta = nil
+		}
+	}
 	split := strings.SplitN(line, " # ", 2)
 	if len(split) > 1 {
 		b.description = split[1]
 	}
-	b.content = strings.TrimSpace(split[0])
+	b.content = unescapeContent(strings.TrimSpace(split[0]))
+	if meta["enc"] == "quoted" {
+		if content, err := strconv.Unquote(b.content); err == nil {
+			b.content = content
+		}
+	}
+	if b.id == "" {
+		b.id = contentID(b.content)
+	}
+}
+
+func (b bookmark) meta() []string {
+	id := b.id
+	if id == "" {
+		id = contentID(b.content)
+	}
+	fields := []string{"id=" + id}
+	if needsQuoting(b.content) {
+		fields = append(fields, "enc=quoted")
+	}
+	switch {
+	case b.image:
+		fields = append(fields, "kind=image")
+	case b.secret:
+		fields = append(fields, "kind=secret")
+	}
+	if len(b.tags) > 0 {
+		fields = append(fields, "tags="+strings.Join(b.tags, ","))
+	}
+	if !b.added.IsZero() {
+		fields = append(fields, fmt.Sprintf("added=%d", b.added.Unix()))
+	}
+	if !b.used.IsZero() {
+		fields = append(fields, fmt.Sprintf("used=%d", b.used.Unix()))
+	}
+	if b.uses > 0 {
+		fields = append(fields, fmt.Sprintf("uses=%d", b.uses))
+	}
+	if b.action != "" {
+		fields = append(fields, "action="+b.action)
+	}
+	return append(fields, b.extraMeta...)
+}
+
+func (b *bookmark) setMeta(meta map[string]string) {
+	b.id = meta["id"]
+	b.image = meta["kind"] == "image"
+	b.secret = meta["kind"] == "secret"
+	if tags, ok := meta["tags"]; ok {
+		b.tags = parseTags(tags)
+	}
+	b.added = parseUnixTime(meta["added"])
+	b.used = parseUnixTime(meta["used"])
+	b.uses, _ = strconv.Atoi(meta["uses"])
+	if slices.Contains(actions, meta["action"]) {
+		b.action = meta["action"]
+	}
+}
+
+func parseUnixTime(s string) time.Time {
+	ts, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || ts <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(ts, 0)
+}
+
+func parseMeta(s string) (map[string]string, bool) {
+	meta := map[string]string{}
+	for _, field := range strings.Fields(s) {
+		kv := strings.SplitN(field, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, false
+		}
+		meta[kv[0]] = kv[1]
+	}
+	return meta, len(meta) > 0
+}
+
+// display returns the line shown in the picker.
+func (b bookmark) display() string {
+	line := b.content
+	if strings.ContainsAny(b.content, "\r\n") {
+		line = strings.Join(strings.FieldsFunc(b.content, func(r rune) bool {
+			return r == '\r' || r == '\n'
+		}), " ⏎ ")
+	}
+	line = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return ' '
+		}
+		return r
+	}, line)
+	if b.image {
+		line = "[image] " + line
+	}
+	if b.secret {
+		line = secretMask
+	}
+	if b.collection != "" {
+		line = "[" + b.collection + "] " + line
+	}
+	if b.description != "" {
+		line += " # " + b.description
+	}
+	for _, tag := range b.tags {
+		line += " #" + tag
+	}
+	return line
+}
+
+// isWebURL reports whether the content is an http(s) URL.
+func isWebURL(content string) bool {
+	u, err := url.Parse(content)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (b bookmark) hasTags(tags []string) bool {
+	for _, tag := range tags {
+		if !slices.Contains(b.tags, tag) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseTags splits a comma or space separated list of tags, dropping
+// the optional leading '#' and duplicates.
+func parseTags(s string) []string {
+	var tags []string
+	for _, tag := range strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}) {
+		tag = strings.TrimLeft(tag, "#")
+		if tag != "" && !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+var trailingTagsRe = regexp.MustCompile(`(\s*#\pL[^\s#,]*)+\s*$`)
+
+// splitDescriptionTags extracts trailing `#tag` words typed into the
+// description prompt. Tags start with a letter, so titles ending with an
+// issue number like "#123" are left alone.
+func splitDescriptionTags(description string) (string, []string) {
+	loc := trailingTagsRe.FindStringIndex(description)
+	if loc == nil {
+		return description, nil
+	}
+	return strings.TrimSpace(description[:loc[0]]),
+		parseTags(description[loc[0]:])
+}
+
+func readBookmarks(bookmarkFile string) ([]bookmark, error) {
+	unlock, err := lockBookmarkFile(bookmarkFile, syscall.LOCK_SH)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer unlock()
+	return readBookmarksUnlocked(bookmarkFile)
+}
+
+func readBookmarksUnlocked(bookmarkFile string) ([]bookmark, error) {
+	fileContent, err := os.ReadFile(bookmarkFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, e.Wrap(err, "read bookmark file")
+	}
+	return parseBookmarks(string(fileContent)), nil
+}
+
+func parseBookmarks(text string) []bookmark {
+	var bookmarks []bookmark
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var b bookmark
+		b.deserialize(line)
+		bookmarks = append(bookmarks, b)
+	}
+	return bookmarks
+}
+
+// writeBookmarks replaces the bookmark file, the caller must hold an
+// exclusive lock on it.
+func writeBookmarks(bookmarks []bookmark, bookmarkFile string) error {
+	lines := util.Map(bookmark.serialize, bookmarks)
+	err := util.WriteFileAtomic(bookmarkFile, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	return e.Wrap(err, "write bookmark file")
+}
+
+// sortBookmarks orders bookmarks in place according to the `sort`
+// variable. Bookmarks without timestamps are treated as the oldest ones:
+// they keep their order in the file for "date", and come in reverse
+// order, like the newest first, for "-date", "-used" and "frecency".
+func sortBookmarks(bookmarks []bookmark, order string) {
+	byAdded := func(i, j int) bool {
+		return bookmarks[i].added.Before(bookmarks[j].added)
+	}
+	switch order {
+	case "date":
+		sort.SliceStable(bookmarks, byAdded)
+	case "-date":
+		sort.SliceStable(bookmarks, byAdded)
+		reverse(bookmarks)
+	case "-used":
+		sort.SliceStable(bookmarks, byAdded)
+		reverse(bookmarks)
+		sort.SliceStable(bookmarks, func(i, j int) bool {
+			return bookmarks[i].used.After(bookmarks[j].used)
+		})
+	case "frecency":
+		sort.SliceStable(bookmarks, byAdded)
+		reverse(bookmarks)
+		now := time.Now()
+		sort.SliceStable(bookmarks, func(i, j int) bool {
+			return bookmarks[i].frecency(now) > bookmarks[j].frecency(now)
+		})
+	case "name":
+		sort.SliceStable(bookmarks, func(i, j int) bool {
+			return strings.ToLower(bookmarks[i].display()) <
+				strings.ToLower(bookmarks[j].display())
+		})
+	}
+}
+
+// frecency scores a bookmark by its use count weighted by how recently
+// it was last used, the same way zoxide ranks directories.
+func (b bookmark) frecency(now time.Time) float64 {
+	if b.uses == 0 {
+		return 0
+	}
+	score := float64(b.uses)
+	switch age := now.Sub(b.used); {
+	case age < time.Hour:
+		return score * 4
+	case age < 24*time.Hour:
+		return score * 2
+	case age < 7*24*time.Hour:
+		return score / 2
+	default:
+		return score / 4
+	}
+}
+
+func reverse[T any](xs []T) {
+	for i, j := 0, len(xs)-1; i < j; i, j = i+1, j-1 {
+		xs[i], xs[j] = xs[j], xs[i]
+	}
 }
 
-func getBookmarkDescription(content string) (string, error) {
-	description, err := prompt(content)
+// markBookmarkUsed updates the last-used timestamp and the use count of
+// the bookmark with the given content.
+func markBookmarkUsed(content string, bookmarkFile string) error {
+	return updateBookmarks(bookmarkFile, func(bookmarks []bookmark) ([]bookmark, error) {
+		i := slices.IndexFunc(bookmarks, func(b bookmark) bool {
+			return b.content == content
+		})
+		if i != -1 {
+			bookmarks[i].used = time.Now()
+			bookmarks[i].uses++
+		}
+		return bookmarks, nil
+	})
+}
+
+func getBookmarkDescription(content string, defaultText string) (string, error) {
+	description, err := prompt(content, defaultText)
 	if err != nil {
 		return "", e.Wrap(err, "prompt for description")
 	}
 	return description, nil
 }
 
+// bookmarkContents returns the set of normalized contents of the
+// bookmarks, see normalizeContent.
+func bookmarkContents(bookmarks []bookmark) map[string]bool {
+	contents := make(map[string]bool, len(bookmarks))
+	for _, b := range bookmarks {
+		contents[normalizeContent(b.content)] = true
+	}
+	return contents
+}
+
 func doesBookmarkExist(content string, bookmarkFile string) (bool, error) {
-	bytes, err := os.ReadFile(bookmarkFile)
+	bookmarks, err := readBookmarks(bookmarkFile)
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return false, nil
-		} else {
-			return false, e.Wrap(err, "read bookmark file")
-		}
+		return false, e.Wrap(err, "read bookmarks")
 	}
-	re := regexp.MustCompile(
-		fmt.Sprintf(`(?m)^%s(\s+#.*)?$`,
-			regexp.QuoteMeta(string(content))))
-	return re.Find(bytes) != nil, nil
+	return bookmarkContents(bookmarks)[normalizeContent(content)], nil
 }
 
 func addBookmarkToFile(b bookmark, path string) error {
+	return addBookmarksToFile([]bookmark{b}, path)
+}
+
+// addBookmarksToFile appends bookmarks to the file, skipping the ones
+// added by someone else since the caller checked for them.
+func addBookmarksToFile(bookmarks []bookmark, path string) error {
+	if len(bookmarks) == 0 {
+		return nil
+	}
+	unlock, err := lockBookmarkFile(path, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
 	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
 	if err != nil {
 		return e.Wrap(err, "open bookmark file")
 	}
 	defer f.Close()
 
-	line := b.serialize()
 	bytes, err := ioutil.ReadAll(f)
+	if err != nil {
+		return e.Wrap(err, "read bookmark file")
+	}
+	contents := map[string]bool{}
+	for _, line := range strings.Split(string(bytes), "\n") {
+		var b bookmark
+		b.deserialize(line)
+		contents[normalizeContent(b.content)] = true
+	}
+	var lines []string
+	for _, b := range bookmarks {
+		if !contents[normalizeContent(b.content)] {
+			lines = append(lines, b.serialize())
+		}
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	s := strings.Join(lines, "\n")
 	if len(bytes) > 0 && bytes[len(bytes)-1] != '\n' {
-		line = "\n" + line
+		s = "\n" + s
 	}
-	_, err = f.WriteString(line)
+	_, err = f.WriteString(s)
 	return e.Wrap(err, "write bookmark file")
 }
 
-func addBookmarkIfNotExists(c cfg) error {
-	content, err := getBookmarkContent(c.unixPrimarySelection)
+func addBookmarkIfNotExists(b bookmark, c cfg) error {
+	content, image, err := getBookmarkContent(c.unixPrimarySelection, c.images)
 	if err != nil {
 		return e.Wrap(err, "get bookmark content")
 	}
+	if len(image) > 0 {
+		content, err = saveImage(image, c.bookmarkFile)
+		if err != nil {
+			return e.Wrap(err, "save image")
+		}
+		b.image = true
+	}
 	if content == "" {
 		return nil
 	}
-	b, err := addBookmarkContentIfNotExists(content, c)
+	b.content = content
+	b, err = addBookmarkContentIfNotExists(b, c)
 	if err != nil {
 		return e.Wrap(err, "add bookmark content")
 	}
@@ -148,7 +603,17 @@ func addBookmarkIfNotExists(c cfg) error {
 	return nil
 }
 
-func addBookmarkContentIfNotExists(content string, c cfg) (bookmark, error) {
+// asksForDescription reports whether the description of the content is
+// prompted for: 'autoTitle' only does without the prompt for URLs, whose
+// page title is the description.
+func asksForDescription(content string, c cfg) bool {
+	return c.askForDescription && !(c.autoTitle && isWebURL(content))
+}
+
+// addBookmarkContentIfNotExists adds a bookmark with the content, tags
+// and action of b, asking for its description if configured.
+func addBookmarkContentIfNotExists(b bookmark, c cfg) (bookmark, error) {
+	content := b.content
 	exists, err := doesBookmarkExist(content, c.bookmarkFile)
 	if err != nil {
 		return bookmark{}, e.Wrap(err, "check if bookmark exists")
@@ -157,15 +622,33 @@ func addBookmarkContentIfNotExists(content string, c cfg) (bookmark, error) {
 		return bookmark{}, nil
 	}
 	var description string
-	if c.askForDescription {
-		description, err = getBookmarkDescription(content)
+	if (c.autoTitle || c.askForDescription) && !b.secret {
+		description = defaultDescription(content, c.titleTimeout)
+	}
+	if asksForDescription(content, c) {
+		shown := content
+		if b.secret {
+			shown = secretMask
+		}
+		description, err = getBookmarkDescription(shown, description)
 		if err != nil {
 			return bookmark{}, e.Wrap(err, "get bookmark description")
 		}
+		var descriptionTags []string
+		description, descriptionTags = splitDescriptionTags(description)
+		b.tags = parseTags(strings.Join(append(b.tags, descriptionTags...), ","))
 	}
-	b := bookmark{
-		content:     content,
-		description: description,
+	b.description = description
+	b.added = time.Now()
+	if b.secret {
+		passphrase, err := getPassphrase(c.secretCmd, true)
+		if err != nil {
+			return bookmark{}, e.Wrap(err, "get passphrase")
+		}
+		b.content, err = encryptSecret(content, passphrase)
+		if err != nil {
+			return bookmark{}, e.Wrap(err, "encrypt secret")
+		}
 	}
 	err = addBookmarkToFile(b, c.bookmarkFile)
 	if err != nil {
@@ -193,6 +676,29 @@ func defaultPickLine(lines []string) (string, error) {
 	return line, nil
 }
 
+// uniqueLines numbers the repeated lines, e.g. secrets with the same
+// description, so that a picked line tells which one was chosen.
+func uniqueLines(lines []string) []string {
+	seen := map[string]bool{}
+	for _, line := range lines {
+		seen[line] = true
+	}
+	unique := make([]string, len(lines))
+	count := map[string]int{}
+	for i, line := range lines {
+		count[line]++
+		unique[i] = line
+		if count[line] == 1 {
+			continue
+		}
+		for n := count[line]; seen[unique[i]]; n++ {
+			unique[i] = fmt.Sprintf("%s (%d)", line, n)
+		}
+		seen[unique[i]] = true
+	}
+	return unique
+}
+
 func pickWithCmd(text string, pickerCmd []string) (string, error) {
 	cmd := exec.Command(pickerCmd[0], pickerCmd[1:]...)
 	cmd.Stdin = strings.NewReader(text)
@@ -203,65 +709,160 @@ func pickWithCmd(text string, pickerCmd []string) (string, error) {
 	return string(bytes.TrimSpace(bs)), nil
 }
 
-func pickBookmark(pickerCmd []string, bookmarkFile string) (bookmark, error) {
-	fileContent, err := os.ReadFile(bookmarkFile)
-	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return bookmark{}, nil
-		} else {
-			return bookmark{}, e.Wrap(err, "read bookmark file")
+// pickerOutputs are the forms pickerCmd may print the choice in: the
+// line itself, its 0-based index (rofi -format i) or the line fed as
+// "ID<tab>line" cut down to the ID (e.g. fzf --with-nth 2.. | cut -f1).
+var pickerOutputs = []string{"line", "index", "id"}
+
+// key identifies a bookmark among the ones offered to the picker, which
+// may come from several collections.
+func (b bookmark) key() string {
+	if b.collection != "" {
+		return b.collection + ":" + b.id
+	}
+	return b.id
+}
+
+// pickedIndex maps what pickerCmd printed back to the index of the
+// chosen line, -1 if nothing was chosen.
+func pickedIndex(output string, candidates []bookmark, lines []string, pickerOutput string) (int, error) {
+	if output == "" {
+		return -1, nil
+	}
+	switch pickerOutput {
+	case "index":
+		// a pickerCmd set before "index" became the default, like fzf or
+		// dmenu, prints the line instead
+		i, err := strconv.Atoi(output)
+		if err == nil && i >= 0 && i < len(lines) {
+			return i, nil
+		}
+	case "id":
+		key, _, _ := strings.Cut(output, "\t")
+		i := slices.IndexFunc(candidates, func(b bookmark) bool {
+			return b.key() == key
+		})
+		if i == -1 {
+			return 0, e.Errorf("picker printed unknown ID %q", key)
+		}
+		return i, nil
+	}
+	i := slices.Index(lines, output)
+	if i == -1 {
+		return 0, e.Errorf("picker printed unknown line %q", output)
+	}
+	return i, nil
+}
+
+func pickBookmark(pickerCmd []string, pickerOutput string, bookmarks []bookmark, tags []string, order string) (bookmark, error) {
+	sortBookmarks(bookmarks, order)
+	var candidates []bookmark
+	var lines []string
+	for _, b := range bookmarks {
+		if b.hasTags(tags) {
+			candidates = append(candidates, b)
+			lines = append(lines, b.display())
 		}
 	}
-	if len(fileContent) == 0 {
+	if len(lines) == 0 {
 		return bookmark{}, nil
 	}
-	s := string(fileContent)
-	var chosenLine string
-	if len(pickerCmd) != 0 {
-		chosenLine, err = pickWithCmd(s, pickerCmd)
+	var i int
+	var err error
+	if useTermPicker() {
+		i, err = termPickLine(lines)
+		if err != nil {
+			return bookmark{}, e.Wrap(err, "pick line in terminal")
+		}
+	} else if len(pickerCmd) != 0 {
+		lines = uniqueLines(lines)
+		text := lines
+		if pickerOutput == "id" {
+			text = make([]string, len(lines))
+			for j, line := range lines {
+				text[j] = candidates[j].key() + "\t" + line
+			}
+		}
+		output, err := pickWithCmd(strings.Join(text, "\n"), pickerCmd)
 		if err != nil {
 			return bookmark{}, e.Wrap(err, "pick line with custom command")
 		}
+		i, err = pickedIndex(output, candidates, lines, pickerOutput)
+		if err != nil {
+			return bookmark{}, err
+		}
 	} else {
-		lines := strings.Split(s, "\n")
-		chosenLine, err = defaultPickLine(lines)
+		lines = uniqueLines(lines)
+		line, err := defaultPickLine(lines)
 		if err != nil {
 			return bookmark{}, e.Wrap(err, "run default pick line command")
 		}
+		i = slices.Index(lines, line)
 	}
-	var b bookmark
-	b.deserialize(chosenLine)
-	if err != nil {
-		return bookmark{}, e.Wrap(err, "parse bookmark line")
+	if i == -1 {
+		return bookmark{}, nil
 	}
-	return b, nil
+	return candidates[i], nil
 }
 
 func typeKeys(keys string) error {
 	return exec.Command("xdotool", "type", keys).Run()
 }
 
-func outputBookmark(b bookmark, doTypeKeys bool) error {
-	if b == (bookmark{}) {
+func outputBookmark(b bookmark, c cfg) error {
+	if b.content == "" {
 		return nil
 	}
-	err := clipboard.Init()
-	if err != nil {
-		return e.Wrap(err, "init clipboard")
-	}
-	line := b.content + " # " + b.description
-	if term.IsTerminal(int(os.Stdout.Fd())) {
-		fmt.Println(line)
+	if b.image {
+		err := outputImage(b, c.bookmarkFile)
+		if err != nil {
+			return e.Wrap(err, "output image")
+		}
+		return e.Wrap(markBookmarkUsed(b.content, c.bookmarkFile), "mark bookmark used")
 	}
-	if doTypeKeys {
-		err := typeKeys(b.content)
+	content := b.content
+	shown := content + " # " + b.description
+	// what placeholder prompts show of the content
+	prompted := content
+	var clearAfter time.Duration
+	if b.secret {
+		passphrase, err := getPassphrase(c.secretCmd, false)
+		if err != nil {
+			return e.Wrap(err, "get passphrase")
+		}
+		content, err = decryptSecret(content, passphrase)
 		if err != nil {
-			return e.Wrap(err, "type keys")
+			return e.Wrap(err, "decrypt secret")
 		}
+		shown = secretMask + " # " + b.description
+		prompted = shown
+		clearAfter = c.secretClearAfter
 	}
-	done := clipboard.Write(clipboard.FmtText, []byte(b.content))
-	<-done
-	return nil
+	content, ok, err := fillPlaceholders(content, prompted)
+	if err != nil {
+		return e.Wrap(err, "fill placeholders")
+	}
+	if !ok {
+		return nil
+	}
+	action := c.action
+	if b.action != "" {
+		action = b.action
+	}
+	switch action {
+	case "open":
+		err = e.Wrap(openBookmark(content, c), "open bookmark")
+	case "exec":
+		err = e.Wrap(execBookmark(content), "execute bookmark")
+	case "type":
+		err = e.Wrap(typeKeys(content), "type keys")
+	default:
+		err = copyBookmark(content, shown, clearAfter, c)
+	}
+	if err != nil {
+		return err
+	}
+	return e.Wrap(markBookmarkUsed(b.content, c.bookmarkFile), "mark bookmark used")
 }
 
 func notifyBookmarkAdded(content string, duration time.Duration) error {
@@ -272,14 +873,71 @@ func notifyBookmarkAdded(content string, duration time.Duration) error {
 }
 
 type cfg struct {
-	askForDescription    bool
-	bookmarkFile         string
-	pickerCmd            []string
-	notify               bool
-	notifyDuration       time.Duration
-	typeKeys             bool
-	unixPrimarySelection bool
-	sort                 string
+	askForDescription     bool
+	autoTitle             bool
+	titleTimeout          time.Duration
+	bookmarkFile          string
+	pickerCmd             []string
+	pickerOutput          string
+	notify                bool
+	notifyDuration        time.Duration
+	typeKeys              bool
+	unixPrimarySelection  bool
+	sort                  string
+	collections           map[string]string
+	action                string
+	browserCmd            []string
+	editor                string
+	images                bool
+	gitSync               bool
+	secretCmd             []string
+	secretClearAfter      time.Duration
+	restoreAfter          time.Duration
+	restoreOnPaste        bool
+	writePrimarySelection bool
+}
+
+// defaultCollection is the name of the collection stored in bookmarkFile.
+const defaultCollection = "default"
+
+func (c cfg) collectionFile(name string) (string, error) {
+	if name == "" || name == defaultCollection {
+		return c.bookmarkFile, nil
+	}
+	path, ok := c.collections[name]
+	if !ok {
+		return "", e.Errorf("unknown collection %s (must be one of %v)", name, c.collectionNames())
+	}
+	return path, nil
+}
+
+// collectionNames returns the default collection followed by the
+// configured ones in alphabetical order.
+func (c cfg) collectionNames() []string {
+	names := util.Keys(c.collections)
+	sort.Strings(names)
+	return append([]string{defaultCollection}, names...)
+}
+
+// readCollections reads the bookmarks of every collection, marking each
+// with the collection it belongs to.
+func readCollections(c cfg) ([]bookmark, error) {
+	var all []bookmark
+	for _, name := range c.collectionNames() {
+		path, err := c.collectionFile(name)
+		if err != nil {
+			return nil, err
+		}
+		bookmarks, err := readBookmarks(path)
+		if err != nil {
+			return nil, e.Wrapf(err, "read collection %s", name)
+		}
+		for i := range bookmarks {
+			bookmarks[i].collection = name
+		}
+		all = append(all, bookmarks...)
+	}
+	return all, nil
 }
 
 type cfgEdit struct {
@@ -296,10 +954,22 @@ func getConfig(x *Z.Cmd) (cfg, error) {
 	if err != nil {
 		return cfg{}, err
 	}
+	pickerOutput, err := util.GetEnum(x, `pickerOutput`, pickerOutputs)
+	if err != nil {
+		return cfg{}, err
+	}
 	askForDescription, err := util.Get[bool](x, `askForDescription`)
 	if err != nil {
 		return cfg{}, err
 	}
+	autoTitle, err := util.Get[bool](x, `autoTitle`)
+	if err != nil {
+		return cfg{}, err
+	}
+	titleTimeout, err := util.Get[time.Duration](x, `titleTimeout`)
+	if err != nil {
+		return cfg{}, err
+	}
 	notify, err := util.Get[bool](x, `notify`)
 	if err != nil {
 		return cfg{}, err
@@ -316,19 +986,77 @@ func getConfig(x *Z.Cmd) (cfg, error) {
 	if err != nil {
 		return cfg{}, err
 	}
-	sort, err := util.GetEnum(x, `sort`, []string{"-date", "date"})
+	sort, err := util.GetEnum(x, `sort`, []string{"-date", "date", "-used", "frecency", "name"})
+	if err != nil {
+		return cfg{}, err
+	}
+	collections, err := util.Get[map[string]string](x, `collections`)
+	if err != nil {
+		return cfg{}, err
+	}
+	action, err := util.GetEnum(x, `action`, actions)
+	if err != nil {
+		return cfg{}, err
+	}
+	browserCmd, err := util.Get[[]string](x, `browserCmd`)
+	if err != nil {
+		return cfg{}, err
+	}
+	editor, err := util.Get[string](x, `editor`)
+	if err != nil {
+		return cfg{}, err
+	}
+	images, err := util.Get[bool](x, `images`)
+	if err != nil {
+		return cfg{}, err
+	}
+	gitSync, err := util.Get[bool](x, `gitSync`)
+	if err != nil {
+		return cfg{}, err
+	}
+	secretCmd, err := util.Get[[]string](x, `secretCmd`)
+	if err != nil {
+		return cfg{}, err
+	}
+	secretClearAfter, err := util.Get[time.Duration](x, `secretClearAfter`)
+	if err != nil {
+		return cfg{}, err
+	}
+	restoreClipboard, err := util.Get[string](x, `restoreClipboard`)
+	if err != nil {
+		return cfg{}, err
+	}
+	restoreAfter, restoreOnPaste, err := parseRestoreClipboard(restoreClipboard)
+	if err != nil {
+		return cfg{}, err
+	}
+	writePrimarySelection, err := util.Get[bool](x, `writePrimarySelection`)
 	if err != nil {
 		return cfg{}, err
 	}
 	return cfg{
-		askForDescription:    askForDescription,
-		bookmarkFile:         bookmarkFile,
-		pickerCmd:            pickerCmd,
-		notify:               notify,
-		notifyDuration:       notifyDuration,
-		typeKeys:             typeKeys,
-		unixPrimarySelection: unixPrimarySelection,
-		sort:                 sort,
+		askForDescription:     askForDescription,
+		autoTitle:             autoTitle,
+		titleTimeout:          titleTimeout,
+		bookmarkFile:          bookmarkFile,
+		pickerCmd:             pickerCmd,
+		pickerOutput:          pickerOutput,
+		notify:                notify,
+		notifyDuration:        notifyDuration,
+		typeKeys:              typeKeys,
+		unixPrimarySelection:  unixPrimarySelection,
+		sort:                  sort,
+		collections:           collections,
+		action:                action,
+		browserCmd:            browserCmd,
+		editor:                editor,
+		images:                images,
+		gitSync:               gitSync,
+		secretCmd:             secretCmd,
+		secretClearAfter:      secretClearAfter,
+		restoreAfter:          restoreAfter,
+		restoreOnPaste:        restoreOnPaste,
+		writePrimarySelection: writePrimarySelection,
 	}, nil
 }
 
@@ -337,11 +1065,7 @@ func getEditConfig(x *Z.Cmd) (cfgEdit, error) {
 	if err != nil {
 		return cfgEdit{}, err
 	}
-	editor, err := util.Get[string](x, `editor`)
-	if err != nil {
-		return cfgEdit{}, err
-	}
-	editorPath, err := util.FindEditor(editor)
+	editorPath, err := util.FindEditor(c.editor)
 	if err != nil {
 		return cfgEdit{}, err
 	}
@@ -351,39 +1075,423 @@ func getEditConfig(x *Z.Cmd) (cfgEdit, error) {
 	}, nil
 }
 
-func cmd(x *Z.Cmd) error {
-	c, err := getConfig(x)
-	if err != nil {
-		return e.Wrap(err, "get config")
-	}
-	b, err := pickBookmark(c.pickerCmd, c.bookmarkFile)
+// tagsFlag collects the values of a repeatable --tag flag.
+type tagsFlag []string
+
+func (t *tagsFlag) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *tagsFlag) Set(s string) error {
+	*t = append(*t, parseTags(s)...)
+	return nil
+}
+
+// options are the flags shared by the bookmark commands.
+type options struct {
+	tags       tagsFlag
+	collection string
+}
+
+func newFlagSet(name string, o *options) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Var(&o.tags, "tag", "")
+	fs.Var(&o.tags, "t", "")
+	fs.StringVar(&o.collection, "collection", "", "")
+	fs.StringVar(&o.collection, "c", "", "")
+	return fs
+}
+
+// parseFlags parses flags interleaved with positional arguments and
+// returns the latter.
+func parseFlags(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, e.Wrap(err, "parse arguments")
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return rest, nil
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+}
+
+// getCollectionConfig returns the config with bookmarkFile pointing to
+// the given collection.
+func getCollectionConfig(x *Z.Cmd, collection string) (cfg, error) {
+	c, err := getConfig(x)
+	if err != nil {
+		return cfg{}, err
+	}
+	c.bookmarkFile, err = c.collectionFile(collection)
+	return c, err
+}
+
+func cmd(x *Z.Cmd, args ...string) error {
+	var o options
+	var all bool
+	fs := newFlagSet(x.Name, &o)
+	fs.BoolVar(&all, "all", false, "")
+	fs.BoolVar(&all, "a", false, "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
+	c, err := getCollectionConfig(x, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	var bookmarks []bookmark
+	if all {
+		bookmarks, err = readCollections(c)
+	} else {
+		bookmarks, err = readBookmarks(c.bookmarkFile)
+	}
+	if err != nil {
+		return e.Wrap(err, "read bookmarks")
+	}
+	b, err := pickBookmark(c.pickerCmd, c.pickerOutput, bookmarks, o.tags, c.sort)
 	if err != nil {
 		return e.Wrap(err, "pick bookmark")
 	}
-	return outputBookmark(b, c.typeKeys)
+	if b.collection != "" {
+		c.bookmarkFile, err = c.collectionFile(b.collection)
+		if err != nil {
+			return err
+		}
+	}
+	return outputBookmark(b, c)
 }
 
 func add(x *Z.Cmd, args ...string) error {
-	c, err := getConfig(x.Caller)
+	var o options
+	var action string
+	fs := newFlagSet(x.Name, &o)
+	var secret bool
+	fs.StringVar(&action, "action", "", "")
+	fs.BoolVar(&secret, "secret", false, "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if action != "" && !slices.Contains(actions, action) {
+		return e.Errorf("invalid action %s (must be one of %v)", action, actions)
+	}
+	var content []string
+	for _, arg := range rest {
+		if strings.HasPrefix(arg, "#") {
+			o.tags = append(o.tags, parseTags(arg)...)
+		} else {
+			content = append(content, arg)
+		}
+	}
+	if len(content) > 1 {
+		return e.Errorf("expected at most one content argument, got %d", len(content))
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
 	if err != nil {
 		return e.Wrap(err, "get config")
 	}
-	if len(args) == 0 {
-		util.Must(addBookmarkIfNotExists(c))
-		return nil
+	b := bookmark{tags: o.tags, action: action, secret: secret}
+	if len(content) == 0 {
+		util.Must(addBookmarkIfNotExists(b, c))
+		return commitIfSynced(c, "Add bookmark")
 	}
-	content := args[0]
-	_, err = addBookmarkContentIfNotExists(content, c)
+	b.content = content[0]
+	if b.content == "-" {
+		text, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return e.Wrap(err, "read content from stdin")
+		}
+		b.content = trimContent(string(text))
+	}
+	_, err = addBookmarkContentIfNotExists(b, c)
 	util.Must(err)
-	return nil
+	return commitIfSynced(c, "Add bookmark")
+}
+
+func list(x *Z.Cmd, args ...string) error {
+	var o options
+	var asJSON bool
+	fs := newFlagSet(x.Name, &o)
+	fs.BoolVar(&asJSON, "json", false, "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	return listBookmarks(c.bookmarkFile, o.tags, asJSON)
+}
+
+func rm(x *Z.Cmd, args ...string) error {
+	var o options
+	rest, err := parseFlags(newFlagSet(x.Name, &o), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return e.New("missing bookmarks to remove")
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	err = removeBookmarks(c.bookmarkFile, rest)
+	if err != nil {
+		return err
+	}
+	return commitIfSynced(c, "Remove bookmarks")
+}
+
+func search(x *Z.Cmd, args ...string) error {
+	var o options
+	var asJSON bool
+	fs := newFlagSet(x.Name, &o)
+	fs.BoolVar(&asJSON, "json", false, "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return e.New("missing search query")
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	return searchBookmarks(c.bookmarkFile, strings.Join(rest, " "), o.tags, asJSON)
+}
+
+func importCall(x *Z.Cmd, args ...string) error {
+	var o options
+	fs := newFlagSet(x.Name, &o)
+	folders := fs.String("folders", "tags", "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 1 {
+		return e.Errorf("expected one file to import, got %d", len(rest))
+	}
+	folderModes := []string{"tags", "description", "none"}
+	if !slices.Contains(folderModes, *folders) {
+		return e.Errorf("invalid value %s for --folders (must be one of %v)", *folders, folderModes)
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	err = importBookmarks(rest[0], *folders, c.bookmarkFile)
+	if err != nil {
+		return err
+	}
+	return commitIfSynced(c, "Import bookmarks")
 }
 
-func edit(x *Z.Cmd) error {
+func export(x *Z.Cmd, args ...string) error {
+	var o options
+	fs := newFlagSet(x.Name, &o)
+	format := fs.String("format", "json", "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
+	if !slices.Contains(exportFormats, *format) {
+		return e.Errorf("invalid value %s for --format (must be one of %v)", *format, exportFormats)
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	return exportBookmarkFile(c.bookmarkFile, *format, o.tags)
+}
+
+func check(x *Z.Cmd, args ...string) error {
+	var o options
+	var asJSON, mark, remove bool
+	fs := newFlagSet(x.Name, &o)
+	fs.BoolVar(&asJSON, "json", false, "")
+	fs.BoolVar(&mark, "mark", false, "")
+	fs.BoolVar(&remove, "remove", false, "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
+	action := checkReport
+	switch {
+	case mark && remove:
+		return e.New("--mark and --remove are mutually exclusive")
+	case mark:
+		action = checkMark
+	case remove:
+		action = checkRemove
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	parallel, err := util.Get[int](x.Caller, `checkParallel`)
+	if err != nil {
+		return err
+	}
+	timeout, err := util.Get[time.Duration](x.Caller, `checkTimeout`)
+	if err != nil {
+		return err
+	}
+	return checkBookmarkFile(c.bookmarkFile, parallel, timeout, action, asJSON)
+}
+
+func edit(x *Z.Cmd, args ...string) error {
+	var o options
+	rest, err := parseFlags(newFlagSet(x.Name, &o), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
 	c, err := getEditConfig(x.Caller)
 	if err != nil {
 		return e.Wrap(err, "get config")
 	}
-	return util.EditFile(c.c.bookmarkFile, c.editorPath)
+	c.c.bookmarkFile, err = c.c.collectionFile(o.collection)
+	if err != nil {
+		return err
+	}
+	err = editBookmarkFile(c.c.bookmarkFile, c.editorPath)
+	if err != nil {
+		return err
+	}
+	return commitIfSynced(c.c, "Edit bookmarks")
+}
+
+// editBookmarkFile opens a copy of the bookmark file in the editor and
+// swaps the result in under an exclusive lock, so that the file is not
+// locked while editing. Bookmarks added or used meanwhile are merged
+// with the edited ones.
+func editBookmarkFile(bookmarkFile string, editorPath string) error {
+	unlock, err := lockBookmarkFile(bookmarkFile, syscall.LOCK_SH)
+	if err != nil {
+		return err
+	}
+	base, err := os.ReadFile(bookmarkFile)
+	unlock()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return e.Wrap(err, "read bookmark file")
+	}
+	f, err := os.CreateTemp("", "bookmarks*")
+	if err != nil {
+		return e.Wrap(err, "create temp file")
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write(base)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return e.Wrap(err, "write temp file")
+	}
+	err = util.EditFile(f.Name(), editorPath)
+	if err != nil {
+		return err
+	}
+	edited, err := os.ReadFile(f.Name())
+	if err != nil {
+		return e.Wrap(err, "read edited file")
+	}
+	unlock, err = lockBookmarkFile(bookmarkFile, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	current, err := os.ReadFile(bookmarkFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return e.Wrap(err, "read bookmark file")
+	}
+	if bytes.Equal(current, base) {
+		err = util.WriteFileAtomic(bookmarkFile, edited, 0644)
+		return e.Wrap(err, "write bookmark file")
+	}
+	return writeBookmarks(mergeBookmarks(parseBookmarks(string(base)),
+		parseBookmarks(string(current)), parseBookmarks(string(edited))), bookmarkFile)
+}
+
+func dedupe(x *Z.Cmd, args ...string) error {
+	var o options
+	var dryRun bool
+	fs := newFlagSet(x.Name, &o)
+	fs.BoolVar(&dryRun, "dry-run", false, "")
+	fs.BoolVar(&dryRun, "n", false, "")
+	rest, err := parseFlags(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	err = dedupeBookmarkFile(c.bookmarkFile, dryRun)
+	if err != nil || dryRun {
+		return err
+	}
+	return commitIfSynced(c, "Dedupe bookmarks")
+}
+
+func syncCall(x *Z.Cmd, args ...string) error {
+	var o options
+	rest, err := parseFlags(newFlagSet(x.Name, &o), args)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return e.Errorf("unexpected arguments: %v", rest)
+	}
+	c, err := getCollectionConfig(x.Caller, o.collection)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	return syncBookmarkFile(c.bookmarkFile)
+}
+
+func serve(x *Z.Cmd, args ...string) error {
+	if len(args) != 0 {
+		return e.Errorf("unexpected arguments: %v", args)
+	}
+	c, err := getConfig(x.Caller)
+	if err != nil {
+		return e.Wrap(err, "get config")
+	}
+	addr, err := util.Get[string](x.Caller, `serveAddr`)
+	if err != nil {
+		return err
+	}
+	token, err := util.Get[string](x.Caller, `serveToken`)
+	if err != nil {
+		return err
+	}
+	return serveBookmarks(c, addr, token)
 }
 
 var Cmd = &Z.Cmd{
@@ -392,21 +1500,82 @@ var Cmd = &Z.Cmd{
 	Commands: []*Z.Cmd{
 		help.Cmd, vars.Cmd, conf.Cmd,
 		initCmd,
-		addCmd, editCmd,
+		addCmd, editCmd, listCmd, rmCmd, searchCmd,
+		importCmd, exportCmd, checkCmd, dedupeCmd, syncCmd, serveCmd,
 	},
 	Call: func(x *Z.Cmd, args ...string) error {
 		defer util.TrapPanic()
-		util.Must(cmd(x))
+		util.Must(cmd(x, args...))
 		return nil
 	},
 	Shortcuts: util.ShortcutsFromDefs(defKeys),
+	// variables added since the last 'init' read as their default
+	VarDefs: defs,
+	Usage:   `[--collection NAME|--all] [--tag TAG]...`,
+	Description: `
+		Pick a bookmark and copy it to the clipboard, or do whatever else
+		the 'action' variable says:
+
+		* "copy" copies it to the clipboard (and types it too when
+		  'typeKeys' is set, and sets the primary selection too when
+		  'writePrimarySelection' is set)
+		* "type" types it with xdotool
+		* "open" opens URLs with 'browserCmd' (xdg-open by default) and
+		  files in 'editor'
+		* "exec" runs it as a shell command
+
+		A bookmark added with --action uses that action instead.
+
+		With 'restoreClipboard' set to a duration (e.g. "20s"), the previous
+		clipboard content (and primary selection) is restored that long
+		after copying, unless something else was copied meanwhile. Set to
+		"paste", it is restored once the bookmark has been pasted; this
+		needs xclip and X11, and applications asking which formats are
+		available before pasting may have it restored too early.
+
+		Bookmarks are picked with 'pickerCmd' (rofi by default) or, when it
+		is empty, a zenity list. 'pickerOutput' tells what pickerCmd prints
+		for the chosen line: "index" (its 0-based index, as with rofi
+		-format i, or else the line itself), "line" (the line itself) or
+		"id" (lines are fed as "ID<tab>line" and the output is read up to
+		the first tab, e.g. fzf --delimiter '\t' --with-nth 2..). Every
+		bookmark is stored with an ID that stays the same when its content
+		is edited.
+
+		In a terminal without a display (e.g. over SSH) a built-in picker
+		is used instead: type to filter the bookmarks fuzzily, move with
+		the arrow keys (or Ctrl-P and Ctrl-N), choose with Enter and cancel
+		with Esc. Without a display there is no clipboard either, so "copy"
+		prints the bookmark instead.
+
+		Bookmarks can be kept in named collections, each stored in its own
+		file. The 'collections' variable maps names to files, e.g.
+		{"work": "/home/me/.bookmarks-work"}, while the "default"
+		collection is 'bookmarkFile'. Every command takes --collection
+		(or -c) to choose one; the picker also takes --all (or -a) to offer
+		bookmarks of every collection, prefixed with "[name]".
+
+		Only bookmarks having every tag given with --tag (or -t) are
+		offered to the picker.
+
+		Bookmarks are ordered by the 'sort' variable: "-date" (newest
+		first), "date" (oldest first), "-used" (most recently used first),
+		"frecency" (most often and recently picked first, like zoxide) or
+		"name" (alphabetical). Bookmarks added before timestamps were
+		recorded count as the oldest ones.
+
+		Bookmarks may contain {name} placeholders, e.g.
+		https://jira.example.com/browse/{ticket}. The value of each one is
+		asked for (on the terminal if there is one, else with a dialog) and
+		substituted before the result is copied or typed. Shell expansions
+		like ${name} and escaped {{name}} are left alone.
+	`,
 }
 
 var addCmd = &Z.Cmd{
 	Name:     `add`,
 	Summary:  `add a bookmark`,
-	Usage:    `[content]`,
-	MaxArgs:  1,
+	Usage:    `[--collection NAME] [--tag TAG]... [--action ACTION] [--secret] [content|-] [#TAG]...`,
 	Commands: []*Z.Cmd{help.Cmd},
 	Call: func(x *Z.Cmd, args ...string) error {
 		defer util.TrapPanic()
@@ -416,17 +1585,48 @@ var addCmd = &Z.Cmd{
 	Description: `
 		Add a bookmark.
 
-		If content is not specified, the current clipboard content is used.
+		If content is not specified, the current clipboard content is used;
+		if it is "-", content is read from standard input. Content may span
+		several lines (e.g. code snippets): such bookmarks are stored as a
+		quoted string and shown on one line in the picker.
+
+		With 'images' set, an image in the clipboard (when there is no
+		text) is added as a bookmark too. It is stored as a PNG file in the
+		directory named after the bookmark file with ".images" appended,
+		and put back into the clipboard when picked.
+
+		When 'askForDescription' is set and the content is an http(s) URL,
+		the description prompt is pre-filled with the page title, fetched
+		within 'titleTimeout'. With 'autoTitle' set, the page title is used
+		as the description of URLs without showing the prompt; other
+		content is still prompted for.
+
+		Tags are attached with --tag (or -t), with arguments starting with
+		'#' (quote them from the shell), or by ending the description typed
+		into the prompt with #tag words, e.g. "Cluster dashboard #work #k8s".
+		Tags are stored in the metadata that follows " #| " at the end of
+		each line of the bookmark file, after the content and description.
+
+		--action stores an action to use for this bookmark instead of the
+		'action' variable: copy, type, open or exec.
+
+		--secret encrypts the content (e.g. a token) with a key derived
+		from a passphrase, which is the first line printed by 'secretCmd'
+		(e.g. ["pass", "show", "bookmarks"]) or, if it is empty, asked for
+		twice. Secret bookmarks are shown as "••••" followed by their
+		description in the picker and in placeholder prompts; when copied,
+		the clipboard is cleared after 'secretClearAfter'.
 	`,
 }
 
 var editCmd = &Z.Cmd{
 	Name:     `edit`,
 	Summary:  `edit bookmarks file`,
+	Usage:    `[--collection NAME]`,
 	Commands: []*Z.Cmd{help.Cmd},
 	Call: func(x *Z.Cmd, args ...string) error {
 		defer util.TrapPanic()
-		util.Must(edit(x))
+		util.Must(edit(x, args...))
 		return nil
 	},
 	Description: `
@@ -436,6 +1636,212 @@ var editCmd = &Z.Cmd{
 	`,
 }
 
+var listCmd = &Z.Cmd{
+	Name:     `list`,
+	Aliases:  []string{`ls`},
+	Summary:  `print bookmarks`,
+	Usage:    `[--json] [--collection NAME] [--tag TAG]...`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(list(x, args...))
+		return nil
+	},
+	Description: `
+		Print bookmarks in file order, each prefixed with its index.
+
+		With --json, print a JSON array instead. Only bookmarks having
+		every tag given with --tag are printed.
+	`,
+}
+
+var rmCmd = &Z.Cmd{
+	Name:     `rm`,
+	Summary:  `remove bookmarks`,
+	Usage:    `[--collection NAME] (content|id|index)...`,
+	MinArgs:  1,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(rm(x, args...))
+		return nil
+	},
+	Description: `
+		Remove bookmarks given by their exact content, by their ID (see
+		{{cmd "list"}} --json) or by the index printed by {{cmd "list"}},
+		and print the removed ones.
+	`,
+}
+
+var searchCmd = &Z.Cmd{
+	Name:     `search`,
+	Summary:  `fuzzy search bookmarks`,
+	Usage:    `[--json] [--collection NAME] [--tag TAG]... query...`,
+	MinArgs:  1,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(search(x, args...))
+		return nil
+	},
+	Description: `
+		Print bookmarks whose content or description fuzzy matches the
+		query, best matches first, in the same format as {{cmd "list"}}.
+	`,
+}
+
+var importCmd = &Z.Cmd{
+	Name:     `import`,
+	Summary:  `import browser bookmarks`,
+	Usage:    `[--folders tags|description|none] [--collection NAME] file`,
+	MinArgs:  1,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(importCall(x, args...))
+		return nil
+	},
+	Description: `
+		Import bookmarks exported by a browser, either in the Netscape
+		bookmarks HTML format (Firefox, Chrome, ...) or as a Firefox JSON
+		backup. Bookmarks whose content is already present are skipped.
+
+		Page titles become descriptions. Folder names become tags by
+		default; with --folders description they prefix the description
+		instead ("Folder/Subfolder: title"), with --folders none they are
+		dropped.
+	`,
+}
+
+var exportCmd = &Z.Cmd{
+	Name:     `export`,
+	Summary:  `export bookmarks`,
+	Usage:    `[--format html|json|csv|md] [--collection NAME] [--tag TAG]...`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(export(x, args...))
+		return nil
+	},
+	Description: `
+		Print bookmarks in the given format (json by default):
+
+		* html - Netscape bookmarks file that browsers can import (URLs only)
+		* json - the same array as {{cmd "list"}} --json
+		* csv  - content, description, tags, added, used, uses columns
+		* md   - Markdown link list, non-URL bookmarks as inline code
+
+		Only bookmarks having every tag given with --tag are exported.
+	`,
+}
+
+var checkCmd = &Z.Cmd{
+	Name:     `check`,
+	Summary:  `report dead links`,
+	Usage:    `[--json] [--mark|--remove] [--collection NAME]`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(check(x, args...))
+		return nil
+	},
+	Description: `
+		Request every http(s) bookmark and print the ones answering with a
+		4xx/5xx status or not answering within 'checkTimeout', as a table
+		or, with --json, as a JSON array. At most 'checkParallel' requests
+		run at a time.
+
+		With --mark, broken bookmarks get the "dead" tag; with --remove,
+		they are removed from the bookmark file.
+	`,
+}
+
+var dedupeCmd = &Z.Cmd{
+	Name:     `dedupe`,
+	Summary:  `merge duplicate bookmarks`,
+	Usage:    `[--dry-run] [--collection NAME]`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(dedupe(x, args...))
+		return nil
+	},
+	Description: `
+		Merge bookmarks that are the same once normalized into the first of
+		them, and print the removed ones. With --dry-run (or -n) they are
+		only printed.
+
+		URLs are normalized by lowercasing the scheme and host and dropping
+		default ports, trailing slashes, fragments (except "#/" and "#!"
+		routes) and tracking parameters like utm_* and fbclid; other
+		bookmarks must be equal. The merged bookmark keeps the longest
+		description, all the tags and the added up usage.
+
+		{{cmd "add"}} and {{cmd "import"}} skip bookmarks that are
+		duplicates of existing ones in the same way.
+	`,
+}
+
+var serveCmd = &Z.Cmd{
+	Name:     `serve`,
+	Summary:  `serve bookmarks over a local HTTP/JSON API`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(serve(x, args...))
+		return nil
+	},
+	Description: `
+		Serve the bookmarks on 'serveAddr', which must be a loopback
+		address, so that a browser extension or bookmarklet can add the
+		current tab. Requests must carry 'serveToken' either as an
+		"Authorization: Bearer TOKEN" header or as the token query
+		parameter; if it is empty, a random token is printed on start.
+
+		Endpoints, all answering with JSON like {{cmd "list"}} --json:
+
+		* GET /bookmarks?tag=TAG... lists bookmarks having all the tags
+		* POST /bookmarks adds a bookmark given as {"content": "...",
+		  "description": "...", "tags": ["..."], "action": "..."}; the
+		  description defaults to the page title when 'autoTitle' is set.
+		  The action may only be copy or open: a page the bookmarklet runs
+		  in can read the token, and must not add bookmarks that execute
+		  or type anything. Answers 409 if the bookmark already exists.
+		* GET /search?q=QUERY&tag=TAG... searches like {{cmd "search"}}
+
+		Every endpoint takes a collection query parameter choosing the
+		collection.
+	`,
+}
+
+var syncCmd = &Z.Cmd{
+	Name:     `sync`,
+	Summary:  `sync bookmarks with a git remote`,
+	Usage:    `[--collection NAME]`,
+	Commands: []*Z.Cmd{help.Cmd},
+	Call: func(x *Z.Cmd, args ...string) error {
+		defer util.TrapPanic()
+		util.Must(syncCall(x, args...))
+		return nil
+	},
+	Description: `
+		Commit changes of the bookmark file, pull with rebase from the
+		upstream of the current branch of the git repository the bookmark
+		file is in, and push.
+
+		Conflicting changes of the bookmark file are merged bookmark by
+		bookmark: bookmarks added on either side are kept (the same content
+		only once, combining tags and usage), bookmarks removed on either
+		side are removed, and for a bookmark changed on both sides the
+		local description wins. Conflicts in other files abort the sync.
+
+		With 'gitSync' set, every {{cmd "add"}}, {{cmd "rm"}},
+		{{cmd "import"}} and {{cmd "edit"}} commits the bookmark file right
+		away. Images of image bookmarks are committed along with it. The
+		".lock" file next to the bookmark file should be ignored by git.
+	`,
+}
+
 var initCmd = &Z.Cmd{
 	Name:     `init`,
 	Summary:  `sets all values to defaults`,
@@ -0,0 +1,198 @@
+package bookmark
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/magnickolas/x/util"
+)
+
+func TestDeserialize(t *testing.T) {
+	tests := []struct {
+		line        string
+		content     string
+		description string
+		tags        []string
+		extraMeta   []string
+	}{
+		{"foo", "foo", "", nil, nil},
+		{"foo # bar", "foo", "bar", nil, nil},
+		// plain lines keep parsing as before metadata existed
+		{"foo # a=b #| x=y", "foo", "a=b #| x=y", nil, nil},
+		{"foo # bar #| id=0123abcd tags=a,b", "foo", "bar", []string{"a", "b"}, nil},
+		{"foo #| id=0123abcd future=1 tags=a", "foo", "", []string{"a"}, []string{"future=1"}},
+		{`a \# b # c #| id=0123abcd`, "a # b", "c", nil, nil},
+	}
+	for _, test := range tests {
+		var b bookmark
+		b.deserialize(test.line)
+		if b.content != test.content || b.description != test.description ||
+			!reflect.DeepEqual(b.tags, test.tags) || !reflect.DeepEqual(b.extraMeta, test.extraMeta) {
+			t.Errorf("deserialize(%q) = %q, %q, %v, %v, want %q, %q, %v, %v", test.line,
+				b.content, b.description, b.tags, b.extraMeta,
+				test.content, test.description, test.tags, test.extraMeta)
+		}
+	}
+}
+
+func TestSerializeKeepsUnknownMeta(t *testing.T) {
+	line := "foo # bar #| id=0123abcd tags=a future=1"
+	var b bookmark
+	b.deserialize(line)
+	if got := b.serialize(); got != line {
+		t.Errorf("serialize() = %q, want %q", got, line)
+	}
+}
+
+func TestSerializeSingleLine(t *testing.T) {
+	b := bookmark{id: "0123abcd", content: "foo", description: "hi\nrm -rf ~ #| id=deadbeef action=exec\r\nx"}
+	want := "foo # hi rm -rf ~ #| id=deadbeef action=exec x #| id=0123abcd"
+	if got := b.serialize(); got != want {
+		t.Errorf("serialize() = %q, want %q", got, want)
+	}
+	var got bookmark
+	got.deserialize(want)
+	if got.content != "foo" || got.id != "0123abcd" || got.action != "" {
+		t.Errorf("deserialize(%q) = %+v, want the bookmark foo", want, got)
+	}
+}
+
+func TestSplitDescriptionTags(t *testing.T) {
+	tests := []struct {
+		description string
+		want        string
+		tags        []string
+	}{
+		{"Go docs #go #ref", "Go docs", []string{"go", "ref"}},
+		{"Fix crash · Issue #123", "Fix crash · Issue #123", nil},
+		{"Issue #123 #bug", "Issue #123", []string{"bug"}},
+		{"no tags", "no tags", nil},
+	}
+	for _, test := range tests {
+		got, tags := splitDescriptionTags(test.description)
+		if got != test.want || !reflect.DeepEqual(tags, test.tags) {
+			t.Errorf("splitDescriptionTags(%q) = %q, %v, want %q, %v",
+				test.description, got, tags, test.want, test.tags)
+		}
+	}
+}
+
+func TestPickedIndex(t *testing.T) {
+	candidates := []bookmark{{id: "aaaa"}, {id: "bbbb"}}
+	lines := []string{"https://a.example/", "https://b.example/ # b"}
+	tests := []struct {
+		output       string
+		pickerOutput string
+		want         int
+		wantErr      bool
+	}{
+		{"", "index", -1, false},
+		{"1", "index", 1, false},
+		// pickers that print the line work with the default "index" too
+		{"https://b.example/ # b", "index", 1, false},
+		{"2", "index", 0, true},
+		{"https://a.example/", "line", 0, false},
+		{"bbbb\thttps://b.example/ # b", "id", 1, false},
+		{"cccc", "id", 0, true},
+	}
+	for _, test := range tests {
+		got, err := pickedIndex(test.output, candidates, lines, test.pickerOutput)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("pickedIndex(%q, %s) = %d, %v, want %d (error: %v)",
+				test.output, test.pickerOutput, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+// fakeEditor writes a shell script run as the editor of the file given
+// as $1.
+func fakeEditor(t *testing.T, script string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "editor")
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEditBookmarkFile(t *testing.T) {
+	dir := t.TempDir()
+	bookmarkFile := filepath.Join(dir, "bookmarks")
+	initial := "https://a.example/ #| id=aaaaaaaa\nhttps://b.example/ #| id=bbbbbbbb\n"
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{"alone", `printf 'https://b.example/ # b\n' > "$1"`, []string{"https://b.example/"}},
+		// a bookmark added while editing is not lost
+		{"concurrent add",
+			`printf 'https://b.example/ #| id=bbbbbbbb\n' > "$1"; printf 'https://c.example/\n' >> ` + bookmarkFile,
+			[]string{"https://b.example/", "https://c.example/"}},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(bookmarkFile, []byte(initial), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := editBookmarkFile(bookmarkFile, fakeEditor(t, test.script)); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		bookmarks, err := readBookmarks(bookmarkFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := util.Map(func(b bookmark) string { return b.content }, bookmarks)
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: bookmarks = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestEditBookmarkFileKeepsText(t *testing.T) {
+	bookmarkFile := filepath.Join(t.TempDir(), "bookmarks")
+	if err := os.WriteFile(bookmarkFile, []byte("https://a.example/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// nothing changed the file meanwhile, so it is written as typed
+	err := editBookmarkFile(bookmarkFile, fakeEditor(t, `printf 'https://b.example/  # b\n' > "$1"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := os.ReadFile(bookmarkFile); err != nil || string(data) != "https://b.example/  # b\n" {
+		t.Errorf("read %q, %v, want the edited text", data, err)
+	}
+}
+
+func TestUniqueLines(t *testing.T) {
+	lines := []string{"•••• # a", "x", "•••• # a", "x (2)", "x", "•••• # a"}
+	want := []string{"•••• # a", "x", "•••• # a (2)", "x (2)", "x (3)", "•••• # a (3)"}
+	if got := uniqueLines(lines); !reflect.DeepEqual(got, want) {
+		t.Errorf("uniqueLines() = %q, want %q", got, want)
+	}
+}
+
+func TestAsksForDescription(t *testing.T) {
+	tests := []struct {
+		content   string
+		ask, auto bool
+		want      bool
+	}{
+		{"https://a.example/", true, false, true},
+		{"https://a.example/", true, true, false},
+		// snippets keep their prompt, for a description and #tags
+		{"ssh host", true, true, true},
+		{"ssh host", false, true, false},
+	}
+	for _, test := range tests {
+		c := cfg{askForDescription: test.ask, autoTitle: test.auto}
+		if got := asksForDescription(test.content, c); got != test.want {
+			t.Errorf("asksForDescription(%q, ask %v, auto %v) = %v, want %v",
+				test.content, test.ask, test.auto, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package bookmark
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	e "github.com/pkg/errors"
+)
+
+// trackingParams are query parameters that only tell where a link was
+// found; parameters starting with "utm_" are dropped as well.
+var trackingParams = map[string]bool{
+	"fbclid": true, "gclid": true, "dclid": true, "msclkid": true,
+	"yclid": true, "igshid": true, "mc_cid": true, "mc_eid": true,
+	"_ga": true, "_hsenc": true, "_hsmi": true, "ref_src": true,
+}
+
+// normalizeContent returns the form of the content used to find
+// duplicates. For http(s) URLs, the scheme and host are lowercased,
+// default ports, trailing slashes, tracking parameters and fragments
+// are dropped and the query is sorted; fragments used for routing
+// ("#/" and "#!") are kept. Other content is returned as is.
+func normalizeContent(content string) string {
+	if !isWebURL(content) {
+		return content
+	}
+	u, err := url.Parse(content)
+	if err != nil {
+		return content
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	if port := u.Port(); (u.Scheme == "http" && port == "80") || (u.Scheme == "https" && port == "443") {
+		u.Host = u.Hostname()
+	}
+	u.Path = strings.TrimRight(u.Path, "/")
+	u.RawPath = ""
+	query := u.Query()
+	for key := range query {
+		if trackingParams[strings.ToLower(key)] || strings.HasPrefix(strings.ToLower(key), "utm_") {
+			query.Del(key)
+		}
+	}
+	// Encode sorts by key
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+	if !strings.HasPrefix(u.Fragment, "/") && !strings.HasPrefix(u.Fragment, "!") {
+		u.Fragment = ""
+	}
+	u.RawFragment = ""
+	return u.String()
+}
+
+// mergeDuplicate combines a bookmark with a duplicate of it, keeping the
+// richest (longest) description and adding up their uses.
+func mergeDuplicate(kept, dup bookmark) bookmark {
+	description := kept.description
+	if len(dup.description) > len(description) {
+		description = dup.description
+	}
+	merged := mergeBookmark(kept, dup)
+	merged.description = description
+	merged.uses = kept.uses + dup.uses
+	return merged
+}
+
+// dedupeBookmarks merges bookmarks having the same normalized content
+// into the first of them and returns the result along with the removed
+// duplicates.
+func dedupeBookmarks(bookmarks []bookmark) ([]bookmark, []indexedBookmark) {
+	var kept []bookmark
+	var removed []indexedBookmark
+	index := map[string]int{}
+	for _, ib := range indexBookmarks(bookmarks) {
+		key := normalizeContent(ib.b.content)
+		if i, ok := index[key]; ok {
+			kept[i] = mergeDuplicate(kept[i], ib.b)
+			removed = append(removed, ib)
+			continue
+		}
+		index[key] = len(kept)
+		kept = append(kept, ib.b)
+	}
+	return kept, removed
+}
+
+// dedupeBookmarkFile merges duplicate bookmarks of the file and prints
+// the removed ones; with dryRun the file is left alone.
+func dedupeBookmarkFile(bookmarkFile string, dryRun bool) error {
+	var removed []indexedBookmark
+	if dryRun {
+		bookmarks, err := readBookmarks(bookmarkFile)
+		if err != nil {
+			return e.Wrap(err, "read bookmarks")
+		}
+		_, removed = dedupeBookmarks(bookmarks)
+	} else {
+		err := updateBookmarks(bookmarkFile, func(bookmarks []bookmark) ([]bookmark, error) {
+			var deduped []bookmark
+			deduped, removed = dedupeBookmarks(bookmarks)
+			return deduped, nil
+		})
+		if err != nil {
+			return e.Wrap(err, "dedupe bookmarks")
+		}
+	}
+	err := printBookmarks(os.Stdout, removed, false)
+	if err != nil {
+		return err
+	}
+	verb := "merged"
+	if dryRun {
+		verb = "would merge"
+	}
+	fmt.Printf("%s %s\n", verb, pluralize(len(removed), "duplicate"))
+	return nil
+}
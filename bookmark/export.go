@@ -0,0 +1,139 @@
+package bookmark
+
+import (
+	"encoding/csv"
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/pkg/errors"
+)
+
+var exportFormats = []string{"html", "json", "csv", "md"}
+
+func exportBookmarks(w io.Writer, bookmarks []bookmark, format string) error {
+	switch format {
+	case "html":
+		return exportHTML(w, bookmarks)
+	case "json":
+		return printBookmarks(w, indexBookmarks(bookmarks), true)
+	case "csv":
+		return exportCSV(w, bookmarks)
+	case "md":
+		return exportMarkdown(w, bookmarks)
+	default:
+		return e.Errorf("unknown export format %s", format)
+	}
+}
+
+// exportHTML writes the Netscape bookmarks format that browsers import.
+// Bookmarks that are not URLs (snippets, commands) are left out.
+func exportHTML(w io.Writer, bookmarks []bookmark) error {
+	var sb strings.Builder
+	sb.WriteString(`<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<!-- This is an automatically generated file.
+     It will be read and overwritten.
+     DO NOT EDIT! -->
+<META HTTP-EQUIV="Content-Type" CONTENT="text/html; charset=UTF-8">
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+`)
+	for _, b := range bookmarks {
+		if u, err := url.Parse(b.content); err != nil || u.Scheme == "" {
+			continue
+		}
+		sb.WriteString(`    <DT><A HREF="` + html.EscapeString(b.content) + `"`)
+		if !b.added.IsZero() {
+			fmt.Fprintf(&sb, ` ADD_DATE="%d"`, b.added.Unix())
+		}
+		if !b.used.IsZero() {
+			fmt.Fprintf(&sb, ` LAST_VISIT="%d"`, b.used.Unix())
+		}
+		if len(b.tags) > 0 {
+			sb.WriteString(` TAGS="` + html.EscapeString(strings.Join(b.tags, ",")) + `"`)
+		}
+		title := b.description
+		if title == "" {
+			title = b.content
+		}
+		sb.WriteString(">" + html.EscapeString(title) + "</A>\n")
+	}
+	sb.WriteString("</DL><p>\n")
+	_, err := io.WriteString(w, sb.String())
+	return e.Wrap(err, "write html")
+}
+
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func exportCSV(w io.Writer, bookmarks []bookmark) error {
+	cw := csv.NewWriter(w)
+	records := [][]string{
+		{"content", "description", "tags", "added", "used", "uses"},
+	}
+	for _, b := range bookmarks {
+		records = append(records, []string{
+			b.content,
+			b.description,
+			strings.Join(b.tags, ","),
+			formatOptionalTime(b.added),
+			formatOptionalTime(b.used),
+			strconv.Itoa(b.uses),
+		})
+	}
+	return e.Wrap(cw.WriteAll(records), "write csv")
+}
+
+var markdownEscaper = strings.NewReplacer(
+	`\`, `\\`, `[`, `\[`, `]`, `\]`, `*`, `\*`, `_`, `\_`, "`", "\\`",
+)
+
+// exportMarkdown writes a link list; bookmarks that are not URLs are
+// written as inline code.
+func exportMarkdown(w io.Writer, bookmarks []bookmark) error {
+	var sb strings.Builder
+	for _, b := range bookmarks {
+		if isWebURL(b.content) {
+			title := b.description
+			if title == "" {
+				title = b.content
+			}
+			fmt.Fprintf(&sb, "- [%s](<%s>)", markdownEscaper.Replace(title), b.content)
+		} else {
+			fmt.Fprintf(&sb, "- `` %s ``", b.content)
+			if b.description != "" {
+				sb.WriteString(" — " + markdownEscaper.Replace(b.description))
+			}
+		}
+		for _, tag := range b.tags {
+			sb.WriteString(" `#" + tag + "`")
+		}
+		sb.WriteString("\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return e.Wrap(err, "write markdown")
+}
+
+func exportBookmarkFile(bookmarkFile string, format string, tags []string) error {
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return e.Wrap(err, "read bookmarks")
+	}
+	var exported []bookmark
+	for _, b := range bookmarks {
+		if b.hasTags(tags) {
+			exported = append(exported, b)
+		}
+	}
+	return exportBookmarks(os.Stdout, exported, format)
+}
@@ -0,0 +1,74 @@
+package bookmark
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/magnickolas/x/util"
+	e "github.com/pkg/errors"
+	"golang.design/x/clipboard"
+	"golang.org/x/term"
+)
+
+// imageDir is where the images of a bookmark file are stored.
+func imageDir(bookmarkFile string) string {
+	return bookmarkFile + ".images"
+}
+
+func imagePath(b bookmark, bookmarkFile string) string {
+	return filepath.Join(imageDir(bookmarkFile), b.content)
+}
+
+// saveImage stores a PNG image next to the bookmark file and returns its
+// file name, which is derived from the data so the same image is only
+// stored once.
+func saveImage(data []byte, bookmarkFile string) (string, error) {
+	dir := imageDir(bookmarkFile)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return "", e.Wrap(err, "create image directory")
+	}
+	sum := sha1.Sum(data)
+	name := hex.EncodeToString(sum[:8]) + ".png"
+	err = util.WriteFileAtomic(filepath.Join(dir, name), data, 0644)
+	if err != nil {
+		return "", e.Wrap(err, "write image")
+	}
+	return name, nil
+}
+
+// outputImage puts the image of the bookmark back into the clipboard.
+func outputImage(b bookmark, bookmarkFile string) error {
+	path := imagePath(b, bookmarkFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return e.Wrap(err, "read image")
+	}
+	err = clipboard.Init()
+	if err != nil {
+		return e.Wrap(err, "init clipboard")
+	}
+	if term.IsTerminal(int(os.Stdout.Fd())) {
+		fmt.Println(path)
+	}
+	<-clipboard.Write(clipboard.FmtImage, data)
+	return nil
+}
+
+// removeImages deletes the files of removed image bookmarks.
+func removeImages(bookmarks []bookmark, bookmarkFile string) error {
+	for _, b := range bookmarks {
+		if !b.image {
+			continue
+		}
+		err := os.Remove(imagePath(b, bookmarkFile))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return e.Wrap(err, "remove image")
+		}
+	}
+	return nil
+}
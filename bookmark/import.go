@@ -0,0 +1,271 @@
+package bookmark
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// importedBookmark is a browser bookmark along with the folders it was
+// found in, outermost first.
+type importedBookmark struct {
+	url     string
+	title   string
+	tags    []string
+	folders []string
+	added   time.Time
+}
+
+// rootFolderAttrs mark the <H3> of the built-in root folders in
+// bookmarks.html exports.
+var rootFolderAttrs = []string{"personal_toolbar_folder", "unfiled_bookmarks_folder"}
+
+// rootFolderNames are the names browsers give their built-in root
+// folders, for the exports that do not mark them.
+var rootFolderNames = []string{
+	"bookmarks bar", "bookmarks toolbar", "bookmarks menu",
+	"other bookmarks", "mobile bookmarks",
+}
+
+// parseNetscapeHTML reads the bookmarks.html format exported by
+// Firefox, Chrome and most other browsers. Like with Firefox backups, the
+// built-in roots are not taken as folders.
+func parseNetscapeHTML(r io.Reader) ([]importedBookmark, error) {
+	var (
+		imported []importedBookmark
+		folders  []string
+		// folder name seen in the last <H3>, pushed on the next <DL>
+		folder  *string
+		root    bool
+		current *importedBookmark
+		inTitle bool
+	)
+	z := html.NewTokenizer(r)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return imported, nil
+			}
+			return nil, e.Wrap(z.Err(), "parse html")
+		case html.StartTagToken:
+			t := z.Token()
+			switch t.DataAtom {
+			case atom.H3:
+				folder = new(string)
+				root = slices.ContainsFunc(t.Attr, func(a html.Attribute) bool {
+					return slices.Contains(rootFolderAttrs, strings.ToLower(a.Key))
+				})
+				inTitle = true
+			case atom.Dl:
+				if folder != nil {
+					// the roots are the folders of the outermost list
+					if root || (len(folders) == 1 && slices.Contains(rootFolderNames,
+						strings.ToLower(strings.TrimSpace(*folder)))) {
+						*folder = ""
+					}
+					folders = append(folders, *folder)
+					folder = nil
+				} else {
+					folders = append(folders, "")
+				}
+			case atom.A:
+				current = &importedBookmark{
+					folders: nonEmpty(folders),
+				}
+				for _, a := range t.Attr {
+					switch strings.ToLower(a.Key) {
+					case "href":
+						current.url = a.Val
+					case "tags":
+						current.tags = parseTags(a.Val)
+					case "add_date":
+						current.added = parseUnixTime(a.Val)
+					}
+				}
+				inTitle = true
+			}
+		case html.EndTagToken:
+			switch z.Token().DataAtom {
+			case atom.H3:
+				inTitle = false
+			case atom.A:
+				if current != nil {
+					imported = append(imported, *current)
+					current = nil
+				}
+				inTitle = false
+			case atom.Dl:
+				if len(folders) > 0 {
+					folders = folders[:len(folders)-1]
+				}
+			}
+		case html.TextToken:
+			if !inTitle {
+				continue
+			}
+			text := string(z.Text())
+			if current != nil {
+				current.title += text
+			} else if folder != nil {
+				*folder += text
+			}
+		}
+	}
+}
+
+func nonEmpty(xs []string) []string {
+	var ys []string
+	for _, x := range xs {
+		if x = strings.TrimSpace(x); x != "" {
+			ys = append(ys, x)
+		}
+	}
+	return ys
+}
+
+// firefoxNode is an entry of a Firefox bookmarks backup (.json).
+type firefoxNode struct {
+	Type      string        `json:"type"`
+	Title     string        `json:"title"`
+	URI       string        `json:"uri"`
+	Tags      string        `json:"tags"`
+	Root      string        `json:"root"`
+	DateAdded int64         `json:"dateAdded"`
+	Children  []firefoxNode `json:"children"`
+}
+
+func parseFirefoxJSON(r io.Reader) ([]importedBookmark, error) {
+	var root firefoxNode
+	if err := json.NewDecoder(r).Decode(&root); err != nil {
+		return nil, e.Wrap(err, "decode firefox backup")
+	}
+	var imported []importedBookmark
+	var walk func(n firefoxNode, folders []string)
+	walk = func(n firefoxNode, folders []string) {
+		switch n.Type {
+		case "text/x-moz-place":
+			var added time.Time
+			if n.DateAdded > 0 {
+				added = time.UnixMicro(n.DateAdded)
+			}
+			imported = append(imported, importedBookmark{
+				url:     n.URI,
+				title:   n.Title,
+				tags:    parseTags(n.Tags),
+				folders: folders,
+				added:   added,
+			})
+		case "text/x-moz-place-container":
+			// the built-in roots (menu, toolbar, ...) are not folders
+			// anyone chose a name for
+			if n.Root == "" && n.Title != "" {
+				folders = append(folders[:len(folders):len(folders)], n.Title)
+			}
+			for _, child := range n.Children {
+				walk(child, folders)
+			}
+		}
+	}
+	walk(root, nil)
+	return imported, nil
+}
+
+func parseBrowserBookmarks(path string) ([]importedBookmark, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, e.Wrap(err, "read bookmarks export")
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") ||
+		bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return parseFirefoxJSON(bytes.NewReader(data))
+	}
+	return parseNetscapeHTML(bytes.NewReader(data))
+}
+
+// folderTag turns a folder name into a tag usable in the bookmark file.
+func folderTag(folder string) string {
+	return strings.Join(strings.FieldsFunc(folder, func(r rune) bool {
+		return r == ',' || r == '#' || r == ' ' || r == '\t'
+	}), "-")
+}
+
+func (ib importedBookmark) toBookmark(folderMode string) bookmark {
+	title := strings.Join(strings.Fields(ib.title), " ")
+	if title == ib.url {
+		title = ""
+	}
+	tags := ib.tags
+	switch folderMode {
+	case "tags":
+		for _, folder := range ib.folders {
+			tags = append(tags, folderTag(folder))
+		}
+	case "description":
+		if len(ib.folders) > 0 {
+			title = strings.TrimSpace(strings.Join(ib.folders, "/") + ": " + title)
+		}
+	}
+	return bookmark{
+		content:     strings.TrimSpace(ib.url),
+		description: title,
+		tags:        parseTags(strings.Join(tags, ",")),
+		added:       ib.added,
+	}
+}
+
+func importBookmarks(path string, folderMode string, bookmarkFile string) error {
+	imported, err := parseBrowserBookmarks(path)
+	if err != nil {
+		return e.Wrap(err, "parse browser bookmarks")
+	}
+	existing, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return e.Wrap(err, "read bookmarks")
+	}
+	contents := bookmarkContents(existing)
+	var added []bookmark
+	skipped := 0
+	for _, ib := range imported {
+		b := ib.toBookmark(folderMode)
+		if b.content == "" || strings.HasPrefix(b.content, "place:") {
+			continue
+		}
+		key := normalizeContent(b.content)
+		if contents[key] {
+			skipped++
+			continue
+		}
+		contents[key] = true
+		if b.added.IsZero() {
+			b.added = time.Now()
+		}
+		added = append(added, b)
+	}
+	err = addBookmarksToFile(added, bookmarkFile)
+	if err != nil {
+		return e.Wrap(err, "add bookmarks to file")
+	}
+	fmt.Printf("imported %s, skipped %s\n",
+		pluralize(len(added), "bookmark"), pluralize(skipped, "duplicate"))
+	return nil
+}
+
+func pluralize(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return strconv.Itoa(n) + " " + noun + "s"
+}
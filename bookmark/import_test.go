@@ -0,0 +1,78 @@
+package bookmark
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const firefoxHTML = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks Menu</H1>
+<DL><p>
+    <DT><A HREF="https://menu.example/">Menu</A>
+    <DT><H3 PERSONAL_TOOLBAR_FOLDER="true">Bookmarks Toolbar</H3>
+    <DL><p>
+        <DT><A HREF="https://toolbar.example/">Toolbar</A>
+        <DT><H3>Go</H3>
+        <DL><p>
+            <DT><A HREF="https://go.dev/" TAGS="lang">Go</A>
+        </DL><p>
+    </DL><p>
+    <DT><H3 UNFILED_BOOKMARKS_FOLDER="true">Other Bookmarks</H3>
+    <DL><p>
+        <DT><A HREF="https://other.example/">Other</A>
+    </DL><p>
+</DL>
+`
+
+const chromeHTML = `<!DOCTYPE NETSCAPE-Bookmark-file-1>
+<TITLE>Bookmarks</TITLE>
+<H1>Bookmarks</H1>
+<DL><p>
+    <DT><H3>Bookmarks bar</H3>
+    <DL><p>
+        <DT><A HREF="https://bar.example/">Bar</A>
+    </DL><p>
+    <DT><H3>Mobile bookmarks</H3>
+    <DL><p>
+        <DT><H3>Bookmarks bar</H3>
+        <DL><p>
+            <DT><A HREF="https://nested.example/">Nested</A>
+        </DL><p>
+    </DL><p>
+</DL>
+`
+
+func TestParseNetscapeHTMLSkipsRoots(t *testing.T) {
+	tests := []struct {
+		name    string
+		html    string
+		folders map[string][]string
+	}{
+		{"firefox", firefoxHTML, map[string][]string{
+			"https://menu.example/":    nil,
+			"https://toolbar.example/": nil,
+			"https://go.dev/":          {"Go"},
+			"https://other.example/":   nil,
+		}},
+		// only the outermost folders are roots
+		{"chrome", chromeHTML, map[string][]string{
+			"https://bar.example/":    nil,
+			"https://nested.example/": {"Bookmarks bar"},
+		}},
+	}
+	for _, test := range tests {
+		imported, err := parseNetscapeHTML(strings.NewReader(test.html))
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		folders := map[string][]string{}
+		for _, b := range imported {
+			folders[b.url] = b.folders
+		}
+		if !reflect.DeepEqual(folders, test.folders) {
+			t.Errorf("%s: folders = %v, want %v", test.name, folders, test.folders)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package bookmark
+
+import (
+	"errors"
+	"os"
+	"syscall"
+
+	e "github.com/pkg/errors"
+)
+
+// lockBookmarkFile takes an advisory lock, syscall.LOCK_SH or
+// syscall.LOCK_EX, for the bookmark file and returns the function
+// releasing it. The lock is held on a separate file next to the bookmark
+// file, since rewriting replaces the bookmark file itself.
+func lockBookmarkFile(bookmarkFile string, how int) (func(), error) {
+	f, err := os.OpenFile(bookmarkFile+".lock", os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, e.Wrap(err, "open lock file")
+	}
+	for {
+		err = syscall.Flock(int(f.Fd()), how)
+		if !errors.Is(err, syscall.EINTR) {
+			break
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, e.Wrap(err, "lock bookmark file")
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
+
+// updateBookmarks applies f to the bookmarks of the file and writes the
+// result back, holding an exclusive lock for the whole time.
+func updateBookmarks(bookmarkFile string, f func([]bookmark) ([]bookmark, error)) error {
+	unlock, err := lockBookmarkFile(bookmarkFile, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	bookmarks, err := readBookmarksUnlocked(bookmarkFile)
+	if err != nil {
+		return err
+	}
+	bookmarks, err = f(bookmarks)
+	if err != nil {
+		return err
+	}
+	return writeBookmarks(bookmarks, bookmarkFile)
+}
@@ -0,0 +1,213 @@
+package bookmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// jsonBookmark is the machine readable form of a bookmark.
+type jsonBookmark struct {
+	Index       int        `json:"index"`
+	ID          string     `json:"id"`
+	Content     string     `json:"content"`
+	Description string     `json:"description,omitempty"`
+	Tags        []string   `json:"tags,omitempty"`
+	Added       *time.Time `json:"added,omitempty"`
+	Used        *time.Time `json:"used,omitempty"`
+	Uses        int        `json:"uses,omitempty"`
+	Secret      bool       `json:"secret,omitempty"`
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func (b bookmark) toJSON(index int) jsonBookmark {
+	return jsonBookmark{
+		Index:       index,
+		ID:          b.id,
+		Content:     b.content,
+		Description: b.description,
+		Tags:        b.tags,
+		Added:       optionalTime(b.added),
+		Used:        optionalTime(b.used),
+		Uses:        b.uses,
+		Secret:      b.secret,
+	}
+}
+
+// indexedBookmark is a bookmark along with its 1-based position in the
+// bookmark file, which is what `rm` accepts.
+type indexedBookmark struct {
+	index int
+	b     bookmark
+}
+
+func indexBookmarks(bookmarks []bookmark) []indexedBookmark {
+	indexed := make([]indexedBookmark, len(bookmarks))
+	for i, b := range bookmarks {
+		indexed[i] = indexedBookmark{i + 1, b}
+	}
+	return indexed
+}
+
+func toJSONList(bookmarks []indexedBookmark) []jsonBookmark {
+	out := make([]jsonBookmark, len(bookmarks))
+	for i, ib := range bookmarks {
+		out[i] = ib.b.toJSON(ib.index)
+	}
+	return out
+}
+
+func printBookmarks(w io.Writer, bookmarks []indexedBookmark, asJSON bool) error {
+	if asJSON {
+		out := toJSONList(bookmarks)
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return e.Wrap(enc.Encode(out), "encode bookmarks")
+	}
+	for _, ib := range bookmarks {
+		_, err := fmt.Fprintf(w, "%d\t%s\n", ib.index, ib.b.display())
+		if err != nil {
+			return e.Wrap(err, "print bookmark")
+		}
+	}
+	return nil
+}
+
+// filterBookmarks returns the bookmarks having all the tags.
+func filterBookmarks(bookmarks []bookmark, tags []string) []indexedBookmark {
+	var listed []indexedBookmark
+	for _, ib := range indexBookmarks(bookmarks) {
+		if ib.b.hasTags(tags) {
+			listed = append(listed, ib)
+		}
+	}
+	return listed
+}
+
+func listBookmarks(bookmarkFile string, tags []string, asJSON bool) error {
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return e.Wrap(err, "read bookmarks")
+	}
+	return printBookmarks(os.Stdout, filterBookmarks(bookmarks, tags), asJSON)
+}
+
+// findBookmark returns the position of the bookmark referenced by its
+// exact content, its ID or its 1-based index.
+func findBookmark(bookmarks []bookmark, ref string) (int, error) {
+	if i := slices.IndexFunc(bookmarks, func(b bookmark) bool {
+		return b.content == ref
+	}); i != -1 {
+		return i, nil
+	}
+	if i := slices.IndexFunc(bookmarks, func(b bookmark) bool {
+		return b.id == ref
+	}); i != -1 {
+		return i, nil
+	}
+	if index, err := strconv.Atoi(ref); err == nil {
+		if index < 1 || index > len(bookmarks) {
+			return 0, e.Errorf("index %d out of range [1, %d]", index, len(bookmarks))
+		}
+		return index - 1, nil
+	}
+	return 0, e.Errorf("no bookmark %q", ref)
+}
+
+func removeBookmarks(bookmarkFile string, refs []string) error {
+	var removed []bookmark
+	err := updateBookmarks(bookmarkFile, func(bookmarks []bookmark) ([]bookmark, error) {
+		var indices []int
+		for _, ref := range refs {
+			i, err := findBookmark(bookmarks, ref)
+			if err != nil {
+				return nil, e.Wrap(err, "find bookmark")
+			}
+			if !slices.Contains(indices, i) {
+				indices = append(indices, i)
+			}
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(indices)))
+		for _, i := range indices {
+			fmt.Println(bookmarks[i].display())
+			removed = append(removed, bookmarks[i])
+			bookmarks = slices.Delete(bookmarks, i, i+1)
+		}
+		return bookmarks, nil
+	})
+	if err != nil {
+		return err
+	}
+	return removeImages(removed, bookmarkFile)
+}
+
+// fuzzyScore reports whether all runes of the pattern occur in s in
+// order (ignoring case) and rates the match: consecutive runes and
+// runes at word starts score higher.
+func fuzzyScore(pattern, s string) (int, bool) {
+	p := []rune(strings.ToLower(pattern))
+	if len(p) == 0 {
+		return 0, true
+	}
+	score, pi, streak := 0, 0, 0
+	prev := ' '
+	for _, r := range strings.ToLower(s) {
+		if pi < len(p) && r == p[pi] {
+			pi++
+			streak++
+			score += streak
+			if !unicode.IsLetter(prev) && !unicode.IsDigit(prev) {
+				score += 3
+			}
+		} else {
+			streak = 0
+		}
+		prev = r
+	}
+	return score, pi == len(p)
+}
+
+// fuzzySearch returns the bookmarks having all the tags and matching the
+// query, best match first.
+func fuzzySearch(bookmarks []bookmark, query string, tags []string) []indexedBookmark {
+	var found []indexedBookmark
+	scores := map[int]int{}
+	for _, ib := range indexBookmarks(bookmarks) {
+		if !ib.b.hasTags(tags) {
+			continue
+		}
+		score, ok := fuzzyScore(query, ib.b.content+" "+ib.b.description)
+		if !ok {
+			continue
+		}
+		found = append(found, ib)
+		scores[ib.index] = score
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return scores[found[i].index] > scores[found[j].index]
+	})
+	return found
+}
+
+func searchBookmarks(bookmarkFile string, query string, tags []string, asJSON bool) error {
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return e.Wrap(err, "read bookmarks")
+	}
+	return printBookmarks(os.Stdout, fuzzySearch(bookmarks, query, tags), asJSON)
+}
@@ -0,0 +1,97 @@
+package bookmark
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ncruces/zenity"
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+	"golang.org/x/term"
+)
+
+// placeholderRe matches `{name}` placeholders, leaving alone shell
+// parameter expansions like `${name}` and escaped `{{name}}`.
+var placeholderRe = regexp.MustCompile(`\{([A-Za-z_][\w-]*)\}`)
+
+// placeholderMatches returns the submatch indexes of the placeholders
+// of the content.
+func placeholderMatches(content string) [][]int {
+	var matches [][]int
+	for _, m := range placeholderRe.FindAllStringSubmatchIndex(content, -1) {
+		if m[0] > 0 && strings.ContainsRune("${", rune(content[m[0]-1])) {
+			continue
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// placeholders returns the distinct placeholder names of the content in
+// order of appearance.
+func placeholders(content string) []string {
+	var names []string
+	for _, m := range placeholderMatches(content) {
+		if name := content[m[2]:m[3]]; !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// substitutePlaceholders replaces the placeholders of the content by
+// their values, and only them: `${name}` stays as is even if {name} is
+// a placeholder elsewhere.
+func substitutePlaceholders(content string, values map[string]string) string {
+	var b strings.Builder
+	last := 0
+	for _, m := range placeholderMatches(content) {
+		b.WriteString(content[last:m[0]])
+		b.WriteString(values[content[m[2]:m[3]]])
+		last = m[1]
+	}
+	b.WriteString(content[last:])
+	return b.String()
+}
+
+func promptPlaceholder(name string, shown string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s: ", name)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return "", e.Wrap(err, "read value")
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	return zenity.Entry(
+		fmt.Sprintf("Value of {%s} in `%s`", name, shown),
+		zenity.Title("Bookmark placeholder"),
+		zenity.Width(300),
+	)
+}
+
+// fillPlaceholders asks for the value of every placeholder of the
+// content, showing it as shown (masked for secrets), and substitutes
+// them. It reports false if a prompt was canceled.
+func fillPlaceholders(content string, shown string) (string, bool, error) {
+	names := placeholders(content)
+	if len(names) == 0 {
+		return content, true, nil
+	}
+	values := make(map[string]string, len(names))
+	for _, name := range names {
+		value, err := promptPlaceholder(name, shown)
+		if errors.Is(err, zenity.ErrCanceled) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, e.Wrapf(err, "prompt for %s", name)
+		}
+		values[name] = value
+	}
+	return substitutePlaceholders(content, values), true, nil
+}
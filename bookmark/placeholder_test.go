@@ -0,0 +1,40 @@
+package bookmark
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		content string
+		want    []string
+	}{
+		{"https://example.com/?q={query}", []string{"query"}},
+		{"{a} {b} {a}", []string{"a", "b"}},
+		{"echo ${HOME} {{x}}", nil},
+		{"echo ${t} {t}", []string{"t"}},
+	}
+	for _, test := range tests {
+		if got := placeholders(test.content); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("placeholders(%q) = %v, want %v", test.content, got, test.want)
+		}
+	}
+}
+
+func TestSubstitutePlaceholders(t *testing.T) {
+	values := map[string]string{"t": "V", "q": "go"}
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"echo ${t} {t}", "echo ${t} V"},
+		{"?q={q}&again={q}", "?q=go&again=go"},
+		{"{{t}} {t}", "{{t}} V"},
+	}
+	for _, test := range tests {
+		if got := substitutePlaceholders(test.content, values); got != test.want {
+			t.Errorf("substitutePlaceholders(%q) = %q, want %q", test.content, got, test.want)
+		}
+	}
+}
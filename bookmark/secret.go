@@ -0,0 +1,110 @@
+package bookmark
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ncruces/zenity"
+	e "github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/term"
+)
+
+// secretMask is shown instead of the content of secret bookmarks.
+const secretMask = "••••"
+
+const secretSaltSize = 16
+
+// secretKey derives the encryption key of a secret from the passphrase.
+func secretKey(passphrase string, salt []byte) []byte {
+	return argon2.IDKey([]byte(passphrase), salt, 1, 64*1024, 4, chacha20poly1305.KeySize)
+}
+
+// encryptSecret returns the content encrypted with a key derived from
+// the passphrase, as base64 of salt, nonce and ciphertext.
+func encryptSecret(content string, passphrase string) (string, error) {
+	salt := make([]byte, secretSaltSize, secretSaltSize+chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(salt); err != nil {
+		return "", e.Wrap(err, "generate salt")
+	}
+	aead, err := chacha20poly1305.NewX(secretKey(passphrase, salt))
+	if err != nil {
+		return "", e.Wrap(err, "create cipher")
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", e.Wrap(err, "generate nonce")
+	}
+	sealed := aead.Seal(append(salt, nonce...), nonce, []byte(content), nil)
+	return base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+func decryptSecret(encrypted string, passphrase string) (string, error) {
+	sealed, err := base64.RawStdEncoding.DecodeString(encrypted)
+	if err != nil {
+		return "", e.Wrap(err, "decode secret")
+	}
+	if len(sealed) < secretSaltSize+chacha20poly1305.NonceSizeX {
+		return "", e.New("secret is too short")
+	}
+	salt, sealed := sealed[:secretSaltSize], sealed[secretSaltSize:]
+	nonce, ciphertext := sealed[:chacha20poly1305.NonceSizeX], sealed[chacha20poly1305.NonceSizeX:]
+	aead, err := chacha20poly1305.NewX(secretKey(passphrase, salt))
+	if err != nil {
+		return "", e.Wrap(err, "create cipher")
+	}
+	content, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", e.New("wrong passphrase or corrupted secret")
+	}
+	return string(content), nil
+}
+
+// askPassphrase asks for the passphrase on the terminal if there is one,
+// else with a dialog.
+func askPassphrase(prompt string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "%s: ", prompt)
+		pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", e.Wrap(err, "read passphrase")
+		}
+		return string(pass), nil
+	}
+	_, pass, err := zenity.Password(zenity.Title("Bookmark " + strings.ToLower(prompt)))
+	return pass, err
+}
+
+// getPassphrase returns the output of 'secretCmd' if set, and otherwise
+// asks for the passphrase. With confirm, as when encrypting, it is asked
+// twice so that a typo does not make the secret unrecoverable.
+func getPassphrase(secretCmd []string, confirm bool) (string, error) {
+	if len(secretCmd) != 0 {
+		out, err := exec.Command(secretCmd[0], secretCmd[1:]...).Output()
+		if err != nil {
+			return "", e.Wrap(err, "run secret command")
+		}
+		// like pass, the passphrase is the first line
+		line, _, _ := bytes.Cut(out, []byte("\n"))
+		return string(line), nil
+	}
+	pass, err := askPassphrase("Passphrase")
+	if err != nil || !confirm {
+		return pass, err
+	}
+	again, err := askPassphrase("Confirm passphrase")
+	if err != nil {
+		return "", err
+	}
+	if again != pass {
+		return "", e.New("passphrases do not match")
+	}
+	return pass, nil
+}
@@ -0,0 +1,49 @@
+package bookmark
+
+import (
+	"os/exec"
+	"strings"
+	"time"
+
+	e "github.com/pkg/errors"
+)
+
+// restoreOnPaste is the 'restoreClipboard' value restoring the previous
+// clipboard content once the bookmark has been pasted.
+const restoreOnPaste = "paste"
+
+// parseRestoreClipboard parses 'restoreClipboard': empty (never restore),
+// restoreOnPaste or a duration.
+func parseRestoreClipboard(s string) (time.Duration, bool, error) {
+	switch s {
+	case "":
+		return 0, false, nil
+	case restoreOnPaste:
+		return 0, true, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, false, e.Errorf(`invalid value %s for restoreClipboard (must be empty, "paste" or a positive duration)`, s)
+	}
+	return d, false, nil
+}
+
+func readPrimarySelection() ([]byte, error) {
+	text, err := exec.Command("xsel", "--primary", "--output").Output()
+	return text, e.Wrap(err, "run xsel to get primary selection")
+}
+
+// writePrimarySelection sets the primary selection, which xsel keeps
+// serving in the background.
+func writePrimarySelection(text []byte) error {
+	cmd := exec.Command("xsel", "--primary", "--input")
+	cmd.Stdin = strings.NewReader(string(text))
+	return e.Wrap(cmd.Run(), "run xsel to set primary selection")
+}
+
+// serveOnePaste sets the clipboard and waits until it is pasted once.
+func serveOnePaste(text []byte) error {
+	cmd := exec.Command("xclip", "-selection", "clipboard", "-loops", "1", "-quiet")
+	cmd.Stdin = strings.NewReader(string(text))
+	return e.Wrap(cmd.Run(), "run xclip to serve one paste")
+}
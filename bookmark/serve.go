@@ -0,0 +1,226 @@
+package bookmark
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// maxRequestBytes bounds the body of requests adding a bookmark.
+const maxRequestBytes = 1 << 20
+
+// apiActions are the actions bookmarks added through the API may have.
+// A bookmarklet leaks the token to the page it runs in, so a hostile
+// page must not be able to plant a bookmark that runs or types anything
+// when picked.
+var apiActions = []string{"copy", "open"}
+
+// server exposes the bookmarks of the configured collections over HTTP.
+type server struct {
+	c     cfg
+	token string
+}
+
+// addRequest is the body of POST /bookmarks.
+type addRequest struct {
+	Content     string   `json:"content"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	Action      string   `json:"action"`
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// checkLoopback makes sure the server cannot be reached from other
+// hosts.
+func checkLoopback(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return e.Wrapf(err, "invalid address %s", addr)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+		return e.Errorf("refusing to listen on %s, which is not a loopback address", addr)
+	}
+	return nil
+}
+
+func generateToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", e.Wrap(err, "generate token")
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{err.Error()})
+}
+
+// authorized checks the token given as "Authorization: Bearer TOKEN" or,
+// for bookmarklets, as the token query parameter.
+func (s *server) authorized(r *http.Request) bool {
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// handle wraps an endpoint with CORS headers, so browser extensions can
+// call it, and with authentication.
+func (s *server) handle(f func(*http.Request, string) (int, any, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !s.authorized(r) {
+			writeError(w, http.StatusUnauthorized, e.New("invalid token"))
+			return
+		}
+		bookmarkFile, err := s.c.collectionFile(r.URL.Query().Get("collection"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, err)
+			return
+		}
+		status, v, err := f(r, bookmarkFile)
+		if err != nil {
+			writeError(w, status, err)
+			return
+		}
+		writeJSON(w, status, v)
+	}
+}
+
+func (s *server) bookmarks(r *http.Request, bookmarkFile string) (int, any, error) {
+	switch r.Method {
+	case http.MethodGet:
+		bookmarks, err := readBookmarks(bookmarkFile)
+		if err != nil {
+			return http.StatusInternalServerError, nil, e.Wrap(err, "read bookmarks")
+		}
+		return http.StatusOK, toJSONList(filterBookmarks(bookmarks, r.URL.Query()["tag"])), nil
+	case http.MethodPost:
+		return s.add(r, bookmarkFile)
+	default:
+		return http.StatusMethodNotAllowed, nil, e.Errorf("method %s not allowed", r.Method)
+	}
+}
+
+func (s *server) add(r *http.Request, bookmarkFile string) (int, any, error) {
+	var req addRequest
+	err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxRequestBytes)).Decode(&req)
+	if err != nil {
+		return http.StatusBadRequest, nil, e.Wrap(err, "decode request")
+	}
+	content := trimContent(req.Content)
+	if content == "" {
+		return http.StatusBadRequest, nil, e.New("missing content")
+	}
+	if req.Action != "" && !slices.Contains(apiActions, req.Action) {
+		return http.StatusBadRequest, nil, e.Errorf("invalid action %s (must be one of %v)", req.Action, apiActions)
+	}
+	exists, err := doesBookmarkExist(content, bookmarkFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, e.Wrap(err, "check if bookmark exists")
+	}
+	if exists {
+		return http.StatusConflict, nil, e.New("bookmark already exists")
+	}
+	description := strings.TrimSpace(req.Description)
+	if strings.IndexFunc(description, unicode.IsControl) != -1 {
+		return http.StatusBadRequest, nil, e.New("description must be a single line")
+	}
+	if description == "" && s.c.autoTitle {
+		description = defaultDescription(content, s.c.titleTimeout)
+	}
+	b := bookmark{
+		content:     content,
+		description: description,
+		tags:        parseTags(strings.Join(req.Tags, ",")),
+		added:       time.Now(),
+		action:      req.Action,
+	}
+	err = addBookmarkToFile(b, bookmarkFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, e.Wrap(err, "add bookmark to file")
+	}
+	c := s.c
+	c.bookmarkFile = bookmarkFile
+	err = commitIfSynced(c, "Add bookmark")
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, e.Wrap(err, "read bookmarks")
+	}
+	i, err := findBookmark(bookmarks, content)
+	if err != nil {
+		return http.StatusInternalServerError, nil, err
+	}
+	return http.StatusCreated, bookmarks[i].toJSON(i + 1), nil
+}
+
+func (s *server) search(r *http.Request, bookmarkFile string) (int, any, error) {
+	if r.Method != http.MethodGet {
+		return http.StatusMethodNotAllowed, nil, e.Errorf("method %s not allowed", r.Method)
+	}
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		return http.StatusInternalServerError, nil, e.Wrap(err, "read bookmarks")
+	}
+	query := r.URL.Query()
+	return http.StatusOK, toJSONList(fuzzySearch(bookmarks, query.Get("q"), query["tag"])), nil
+}
+
+// serveBookmarks runs the API on the loopback address until it fails.
+// Without a configured token, a random one is generated and printed.
+func serveBookmarks(c cfg, addr string, token string) error {
+	err := checkLoopback(addr)
+	if err != nil {
+		return err
+	}
+	if token == "" {
+		token, err = generateToken()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("token: %s\n", token)
+	}
+	s := &server{c: c, token: token}
+	mux := http.NewServeMux()
+	mux.Handle("/bookmarks", s.handle(s.bookmarks))
+	mux.Handle("/search", s.handle(s.search))
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return e.Wrap(err, "listen")
+	}
+	fmt.Printf("serving bookmarks on http://%s\n", l.Addr())
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return e.Wrap(srv.Serve(l), "serve")
+}
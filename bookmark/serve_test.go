@@ -0,0 +1,45 @@
+package bookmark
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestServeAddActions(t *testing.T) {
+	bookmarkFile := filepath.Join(t.TempDir(), "bookmarks")
+	s := &server{c: cfg{bookmarkFile: bookmarkFile}, token: "secret"}
+	handler := s.handle(s.bookmarks)
+
+	tests := []struct {
+		body   string
+		token  string
+		status int
+	}{
+		{`{"content": "https://a.example/"}`, "wrong", http.StatusUnauthorized},
+		{`{"content": "https://a.example/", "action": "exec"}`, "secret", http.StatusBadRequest},
+		{`{"content": "https://a.example/", "action": "type"}`, "secret", http.StatusBadRequest},
+		// a line break would start a bookmark of its own
+		{`{"content": "https://a.example/", "description": "hi\nrm -rf ~ #| id=deadbeef action=exec\nx"}`,
+			"secret", http.StatusBadRequest},
+		{`{"content": "https://a.example/", "action": "open"}`, "secret", http.StatusCreated},
+		{`{"content": "https://a.example/"}`, "secret", http.StatusConflict},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/bookmarks?token="+test.token, strings.NewReader(test.body))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		if w.Code != test.status {
+			t.Errorf("POST %s = %d %s, want %d", test.body, w.Code, w.Body, test.status)
+		}
+	}
+	bookmarks, err := readBookmarks(bookmarkFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bookmarks) != 1 || bookmarks[0].action != "open" {
+		t.Errorf("bookmarks = %+v, want the one added with action open", bookmarks)
+	}
+}
@@ -0,0 +1,248 @@
+package bookmark
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/magnickolas/x/util"
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+// git runs git in the directory of the bookmark file and returns its
+// output.
+func git(bookmarkFile string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", filepath.Dir(bookmarkFile)}, args...)...)
+	// rebase --continue must not open an editor for the commit message
+	cmd.Env = append(os.Environ(), "GIT_EDITOR=true")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", e.Wrapf(err, "git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+	return string(out), nil
+}
+
+// syncedPaths are the paths, relative to the directory of the bookmark
+// file, that are committed: the file itself and its images if any.
+func syncedPaths(bookmarkFile string) []string {
+	paths := []string{filepath.Base(bookmarkFile)}
+	if _, err := os.Stat(imageDir(bookmarkFile)); err == nil {
+		paths = append(paths, filepath.Base(imageDir(bookmarkFile)))
+	}
+	return paths
+}
+
+// commitBookmarkFile commits the changes of the bookmark file, if any.
+func commitBookmarkFile(bookmarkFile string, message string) error {
+	paths := append([]string{"--"}, syncedPaths(bookmarkFile)...)
+	_, err := git(bookmarkFile, append([]string{"add"}, paths...)...)
+	if err != nil {
+		return err
+	}
+	// exits with 1 when there are staged changes
+	_, err = git(bookmarkFile, append([]string{"diff", "--cached", "--quiet"}, paths...)...)
+	if err == nil {
+		return nil
+	}
+	_, err = git(bookmarkFile, append([]string{"commit", "-m", message}, paths...)...)
+	return err
+}
+
+// commitIfSynced commits the changes of the bookmark file when 'gitSync'
+// is set.
+func commitIfSynced(c cfg, message string) error {
+	if !c.gitSync {
+		return nil
+	}
+	unlock, err := lockBookmarkFile(c.bookmarkFile, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return e.Wrap(commitBookmarkFile(c.bookmarkFile, message), "commit bookmarks")
+}
+
+// mergeBookmark combines two versions of the same bookmark, preferring
+// ours for the fields that cannot be combined.
+func mergeBookmark(theirs, ours bookmark) bookmark {
+	merged := theirs
+	if ours.description != "" {
+		merged.description = ours.description
+	}
+	if ours.action != "" {
+		merged.action = ours.action
+	}
+	for _, tag := range ours.tags {
+		if !slices.Contains(merged.tags, tag) {
+			merged.tags = append(merged.tags, tag)
+		}
+	}
+	if merged.added.IsZero() || (!ours.added.IsZero() && ours.added.Before(merged.added)) {
+		merged.added = ours.added
+	}
+	if ours.used.After(merged.used) {
+		merged.used = ours.used
+	}
+	if ours.uses > merged.uses {
+		merged.uses = ours.uses
+	}
+	merged.image = merged.image || ours.image
+	return merged
+}
+
+// mergeField returns the value of a field changed from base by either
+// side, preferring ours when both changed it.
+func mergeField[T comparable](base, theirs, ours T) T {
+	if ours == base {
+		return theirs
+	}
+	return ours
+}
+
+// mergeTags keeps the tags of base neither side removed and the ones
+// either side added.
+func mergeTags(base, theirs, ours []string) []string {
+	var merged []string
+	for _, tag := range append(slices.Clone(theirs), ours...) {
+		kept := slices.Contains(theirs, tag) && slices.Contains(ours, tag)
+		if slices.Contains(merged, tag) || (slices.Contains(base, tag) && !kept) {
+			continue
+		}
+		merged = append(merged, tag)
+	}
+	return merged
+}
+
+// mergeBookmark3 merges the changes both sides made to a bookmark since
+// base field by field, so a field changed on one side only is not
+// reverted by the other. Uses made on both sides add up.
+func mergeBookmark3(base, theirs, ours bookmark) bookmark {
+	merged := mergeBookmark(theirs, ours)
+	merged.id = mergeField(base.id, theirs.id, ours.id)
+	merged.content = mergeField(base.content, theirs.content, ours.content)
+	merged.description = mergeField(base.description, theirs.description, ours.description)
+	merged.action = mergeField(base.action, theirs.action, ours.action)
+	merged.image = mergeField(base.image, theirs.image, ours.image)
+	merged.secret = mergeField(base.secret, theirs.secret, ours.secret)
+	merged.tags = mergeTags(base.tags, theirs.tags, ours.tags)
+	merged.uses = util.Max(theirs.uses+ours.uses-base.uses, theirs.uses, ours.uses)
+	return merged
+}
+
+// bookmarksByContent indexes bookmarks by normalized content, merging
+// duplicates, and returns the keys in file order.
+func bookmarksByContent(bookmarks []bookmark) ([]string, map[string]bookmark) {
+	var keys []string
+	byContent := map[string]bookmark{}
+	for _, b := range bookmarks {
+		key := normalizeContent(b.content)
+		if dup, ok := byContent[key]; ok {
+			byContent[key] = mergeBookmark(dup, b)
+			continue
+		}
+		keys = append(keys, key)
+		byContent[key] = b
+	}
+	return keys, byContent
+}
+
+// mergeBookmarks merges two versions of a bookmark file changed from a
+// common base: bookmarks of both are kept, deduplicated by normalized
+// content, except the ones of the base that either side removed.
+// Bookmarks both sides kept are merged with their base version.
+func mergeBookmarks(base, theirs, ours []bookmark) []bookmark {
+	_, inBase := bookmarksByContent(base)
+	theirKeys, inTheirs := bookmarksByContent(theirs)
+	ourKeys, inOurs := bookmarksByContent(ours)
+	var merged []bookmark
+	seen := map[string]bool{}
+	for _, key := range append(theirKeys, ourKeys...) {
+		b, ok := inBase[key]
+		t, inT := inTheirs[key]
+		o, inO := inOurs[key]
+		if seen[key] || (ok && (!inT || !inO)) {
+			continue
+		}
+		seen[key] = true
+		switch {
+		case inT && inO && ok:
+			merged = append(merged, mergeBookmark3(b, t, o))
+		case inT && inO:
+			merged = append(merged, mergeBookmark(t, o))
+		case inT:
+			merged = append(merged, t)
+		default:
+			merged = append(merged, o)
+		}
+	}
+	return merged
+}
+
+// conflictStage returns the bookmarks of a stage of the conflicted
+// bookmark file: 1 is the base, 2 the upstream version the local
+// commit is rebased onto and 3 the local one.
+func conflictStage(bookmarkFile string, stage string) []bookmark {
+	text, err := git(bookmarkFile, "show", ":"+stage+":./"+filepath.Base(bookmarkFile))
+	if err != nil {
+		// the file does not exist on that side
+		return nil
+	}
+	return parseBookmarks(text)
+}
+
+// resolveConflict replaces the conflicted bookmark file by the merge of
+// both sides and marks it resolved.
+func resolveConflict(bookmarkFile string) error {
+	merged := mergeBookmarks(
+		conflictStage(bookmarkFile, "1"),
+		conflictStage(bookmarkFile, "2"),
+		conflictStage(bookmarkFile, "3"),
+	)
+	err := writeBookmarks(merged, bookmarkFile)
+	if err != nil {
+		return err
+	}
+	_, err = git(bookmarkFile, "add", "--", filepath.Base(bookmarkFile))
+	return err
+}
+
+// syncBookmarkFile commits local changes, rebases them onto the upstream
+// ones, merging conflicting versions of the bookmark file, and pushes
+// the result.
+func syncBookmarkFile(bookmarkFile string) error {
+	unlock, err := lockBookmarkFile(bookmarkFile, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	err = commitBookmarkFile(bookmarkFile, "Sync bookmarks")
+	if err != nil {
+		return e.Wrap(err, "commit bookmarks")
+	}
+	_, err = git(bookmarkFile, "pull", "--rebase")
+	for err != nil {
+		conflicts, diffErr := git(bookmarkFile, "diff", "--name-only", "--diff-filter=U", "--relative")
+		conflicts = strings.TrimSpace(conflicts)
+		if diffErr != nil || conflicts == "" {
+			return e.Wrap(err, "pull")
+		}
+		if conflicts != filepath.Base(bookmarkFile) {
+			git(bookmarkFile, "rebase", "--abort")
+			return e.Errorf("cannot merge conflicting changes of %s", strings.Join(strings.Fields(conflicts), ", "))
+		}
+		err = resolveConflict(bookmarkFile)
+		if err != nil {
+			git(bookmarkFile, "rebase", "--abort")
+			return e.Wrap(err, "resolve conflict")
+		}
+		_, err = git(bookmarkFile, "rebase", "--continue")
+	}
+	_, err = git(bookmarkFile, "push")
+	return e.Wrap(err, "push")
+}
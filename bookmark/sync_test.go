@@ -0,0 +1,132 @@
+package bookmark
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMergeBookmarks(t *testing.T) {
+	base := parseBookmarks(`https://a.example/ # A #| id=aaaaaaaa tags=x,y uses=2
+https://b.example/ # B #| id=bbbbbbbb
+https://c.example/ # C #| id=cccccccc`)
+	// upstream renamed A and dropped its tag y, and removed C
+	theirs := parseBookmarks(`https://a.example/ # A renamed #| id=aaaaaaaa tags=x uses=2
+https://b.example/ # B #| id=bbbbbbbb`)
+	// locally, A was picked twice and tagged z, B was given an action and
+	// D was added
+	ours := parseBookmarks(`https://a.example/ # A #| id=aaaaaaaa tags=x,y,z uses=4
+https://b.example/ # B #| id=bbbbbbbb action=open
+https://c.example/ # C #| id=cccccccc
+https://d.example/ # D #| id=dddddddd`)
+
+	merged := mergeBookmarks(base, theirs, ours)
+	want := []bookmark{
+		{id: "aaaaaaaa", content: "https://a.example/", description: "A renamed",
+			tags: []string{"x", "z"}, uses: 4},
+		{id: "bbbbbbbb", content: "https://b.example/", description: "B", action: "open"},
+		{id: "dddddddd", content: "https://d.example/", description: "D"},
+	}
+	if !reflect.DeepEqual(merged, want) {
+		t.Errorf("mergeBookmarks() =\n%+v\nwant\n%+v", merged, want)
+	}
+}
+
+func TestMergeBookmarksAddedOnBothSides(t *testing.T) {
+	theirs := parseBookmarks(`https://a.example/ # theirs #| id=aaaaaaaa tags=x uses=1`)
+	ours := parseBookmarks(`https://a.example/?utm_source=x #| id=aaaaaaaa tags=y uses=3`)
+	merged := mergeBookmarks(nil, theirs, ours)
+	if len(merged) != 1 {
+		t.Fatalf("mergeBookmarks() = %+v, want one bookmark", merged)
+	}
+	if merged[0].description != "theirs" || !reflect.DeepEqual(merged[0].tags, []string{"x", "y"}) ||
+		merged[0].uses != 3 {
+		t.Errorf("mergeBookmarks() = %+v", merged[0])
+	}
+}
+
+// gitRun runs git in dir, failing the test on error.
+func gitRun(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, out)
+	}
+}
+
+func TestSyncBookmarkFile(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	t.Setenv("GIT_AUTHOR_NAME", "test")
+	t.Setenv("GIT_AUTHOR_EMAIL", "test@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "test")
+	t.Setenv("GIT_COMMITTER_EMAIL", "test@example.com")
+
+	remote := filepath.Join(dir, "remote.git")
+	local := filepath.Join(dir, "local")
+	other := filepath.Join(dir, "other")
+	gitRun(t, dir, "init", "--bare", "-q", remote)
+	gitRun(t, dir, "clone", "-q", remote, local)
+	gitRun(t, local, "checkout", "-q", "-b", "main")
+
+	localFile := filepath.Join(local, "bookmarks")
+	write := func(file string, text string) {
+		t.Helper()
+		if err := os.WriteFile(file, []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(localFile, "https://a.example/ # A #| id=aaaaaaaa tags=x,y\n")
+	if err := commitBookmarkFile(localFile, "Add bookmarks"); err != nil {
+		t.Fatal(err)
+	}
+	gitRun(t, local, "push", "-q", "-u", "origin", "main")
+	gitRun(t, dir, "clone", "-q", "-b", "main", remote, other)
+
+	// the other clone renames the bookmark and drops a tag
+	otherFile := filepath.Join(other, "bookmarks")
+	write(otherFile, "https://a.example/ # A renamed #| id=aaaaaaaa tags=x\n")
+	if err := syncBookmarkFile(otherFile); err != nil {
+		t.Fatal(err)
+	}
+
+	// meanwhile, the bookmark is picked locally and another one added
+	used := time.Unix(1700000000, 0)
+	write(localFile, "https://a.example/ # A #| id=aaaaaaaa tags=x,y used=1700000000 uses=1\n"+
+		"https://b.example/ # B #| id=bbbbbbbb\n")
+	if err := syncBookmarkFile(localFile); err != nil {
+		t.Fatal(err)
+	}
+
+	bookmarks, err := readBookmarks(localFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []bookmark{
+		{id: "aaaaaaaa", content: "https://a.example/", description: "A renamed",
+			tags: []string{"x"}, used: used, uses: 1},
+		{id: "bbbbbbbb", content: "https://b.example/", description: "B"},
+	}
+	if !reflect.DeepEqual(bookmarks, want) {
+		t.Errorf("synced bookmarks =\n%+v\nwant\n%+v", bookmarks, want)
+	}
+
+	// the merge was pushed, so the other clone gets it as is
+	if err := syncBookmarkFile(otherFile); err != nil {
+		t.Fatal(err)
+	}
+	otherBookmarks, err := readBookmarks(otherFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(otherBookmarks, want) {
+		t.Errorf("bookmarks of the other clone =\n%+v\nwant\n%+v", otherBookmarks, want)
+	}
+}
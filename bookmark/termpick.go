@@ -0,0 +1,183 @@
+package bookmark
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/term"
+)
+
+// hasDisplay reports whether there is an X11 or Wayland display for
+// rofi, zenity and the clipboard.
+func hasDisplay() bool {
+	return os.Getenv("DISPLAY") != "" || os.Getenv("WAYLAND_DISPLAY") != ""
+}
+
+// useTermPicker reports whether the picker should run in the terminal:
+// there is one to interact with and no display for rofi or zenity.
+func useTermPicker() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) &&
+		term.IsTerminal(int(os.Stdout.Fd())) && !hasDisplay()
+}
+
+// termPicker is the state of the terminal picker: the indexes of the
+// lines matching the query, best match first, and the selected one among
+// them. Lines are told apart by index, so identical ones can be picked.
+type termPicker struct {
+	lines    []string
+	query    []rune
+	matches  []int
+	selected int
+	offset   int
+}
+
+func (p *termPicker) filter() {
+	p.matches = p.matches[:0]
+	scores := map[int]int{}
+	for i, line := range p.lines {
+		if score, ok := fuzzyScore(string(p.query), line); ok {
+			p.matches = append(p.matches, i)
+			scores[i] = score
+		}
+	}
+	sort.SliceStable(p.matches, func(i, j int) bool {
+		return scores[p.matches[i]] > scores[p.matches[j]]
+	})
+	p.selected, p.offset = 0, 0
+}
+
+func (p *termPicker) move(delta int) {
+	p.selected += delta
+	if p.selected >= len(p.matches) {
+		p.selected = len(p.matches) - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+func truncate(s string, width int) string {
+	if utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	return string([]rune(s)[:width])
+}
+
+// render draws the prompt and the visible matches below the cursor and
+// leaves the cursor at the end of the query.
+func (p *termPicker) render() string {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width < 4 || height < 2 {
+		width, height = 80, 24
+	}
+	rows := height - 1
+	if rows > len(p.matches) {
+		rows = len(p.matches)
+	}
+	if p.selected < p.offset {
+		p.offset = p.selected
+	}
+	if p.selected >= p.offset+rows {
+		p.offset = p.selected - rows + 1
+	}
+	var sb strings.Builder
+	prompt := truncate(fmt.Sprintf("%d/%d> %s", len(p.matches), len(p.lines), string(p.query)), width-1)
+	sb.WriteString("\r\x1b[J" + prompt)
+	for i := p.offset; i < p.offset+rows; i++ {
+		line := truncate(p.lines[p.matches[i]], width-3)
+		if i == p.selected {
+			sb.WriteString("\r\n\x1b[7m> " + line + "\x1b[0m")
+		} else {
+			sb.WriteString("\r\n  " + line)
+		}
+	}
+	if rows > 0 {
+		fmt.Fprintf(&sb, "\x1b[%dA", rows)
+	}
+	fmt.Fprintf(&sb, "\r\x1b[%dC", utf8.RuneCountInString(prompt))
+	return sb.String()
+}
+
+// handle applies a chunk of input and reports whether picking is over
+// and the index of the chosen line, -1 if none.
+func (p *termPicker) handle(input []byte) (int, bool) {
+	switch s := string(input); s {
+	case "\r", "\n":
+		if len(p.matches) == 0 {
+			return -1, false
+		}
+		return p.matches[p.selected], true
+	case "\x1b", "\x03", "\x04":
+		return -1, true
+	case "\x1b[A", "\x1bOA", "\x10":
+		p.move(-1)
+	case "\x1b[B", "\x1bOB", "\x0e", "\t":
+		p.move(1)
+	case "\x1b[5~":
+		p.move(-10)
+	case "\x1b[6~":
+		p.move(10)
+	case "\x7f", "\x08":
+		if len(p.query) > 0 {
+			p.query = p.query[:len(p.query)-1]
+			p.filter()
+		}
+	case "\x15":
+		p.query = p.query[:0]
+		p.filter()
+	case "\x17":
+		q := strings.TrimRightFunc(string(p.query), unicode.IsSpace)
+		i := strings.LastIndexFunc(q, unicode.IsSpace)
+		p.query = []rune(q[:i+1])
+		p.filter()
+	default:
+		if strings.HasPrefix(s, "\x1b") {
+			break
+		}
+		changed := false
+		for _, r := range s {
+			if unicode.IsPrint(r) {
+				p.query = append(p.query, r)
+				changed = true
+			}
+		}
+		if changed {
+			p.filter()
+		}
+	}
+	return -1, false
+}
+
+// termPickLine lets the user pick one of the lines by typing a fuzzy
+// query in the terminal. It returns the index of the chosen line, -1 if
+// picking was canceled.
+func termPickLine(lines []string) (int, error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return -1, e.Wrap(err, "make terminal raw")
+	}
+	defer term.Restore(fd, state)
+	p := &termPicker{lines: lines}
+	p.filter()
+	defer os.Stdout.WriteString("\r\x1b[J")
+	buf := make([]byte, 64)
+	for {
+		_, err := os.Stdout.WriteString(p.render())
+		if err != nil {
+			return -1, e.Wrap(err, "render picker")
+		}
+		n, err := os.Stdin.Read(buf)
+		if err != nil {
+			return -1, e.Wrap(err, "read input")
+		}
+		if i, done := p.handle(buf[:n]); done {
+			return i, nil
+		}
+	}
+}
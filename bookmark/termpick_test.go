@@ -0,0 +1,20 @@
+package bookmark
+
+import "testing"
+
+func TestTermPickerIdenticalLines(t *testing.T) {
+	p := &termPicker{lines: []string{"•••• # mail", "other", "•••• # mail"}}
+	p.filter()
+	for _, input := range []string{"m", "\x1b[B"} {
+		if _, done := p.handle([]byte(input)); done {
+			t.Fatalf("picking ended on %q", input)
+		}
+	}
+	// the second of the identical lines is told apart by its index
+	if i, done := p.handle([]byte("\r")); !done || i != 2 {
+		t.Errorf("handle(enter) = %d, %v, want 2, true", i, done)
+	}
+	if i, done := p.handle([]byte("\x1b")); !done || i != -1 {
+		t.Errorf("handle(escape) = %d, %v, want -1, true", i, done)
+	}
+}
@@ -0,0 +1,74 @@
+package bookmark
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxTitleBytes bounds how much of a page is read looking for <title>.
+const maxTitleBytes = 1 << 20
+
+// fetchTitle returns the <title> of the page at the given URL.
+func fetchTitle(pageURL string, timeout time.Duration) (string, error) {
+	client := http.Client{Timeout: timeout}
+	req, err := http.NewRequest(http.MethodGet, pageURL, nil)
+	if err != nil {
+		return "", e.Wrap(err, "create request")
+	}
+	req.Header.Set("Accept", "text/html")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", e.Wrap(err, "get page")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", e.Errorf("get page: %s", resp.Status)
+	}
+	return parseTitle(io.LimitReader(resp.Body, maxTitleBytes))
+}
+
+func parseTitle(r io.Reader) (string, error) {
+	z := html.NewTokenizer(r)
+	inTitle := false
+	var title strings.Builder
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if z.Err() == io.EOF {
+				return "", nil
+			}
+			return "", e.Wrap(z.Err(), "parse html")
+		case html.StartTagToken:
+			if z.Token().DataAtom == atom.Title {
+				inTitle = true
+			}
+		case html.EndTagToken:
+			if inTitle && z.Token().DataAtom == atom.Title {
+				return strings.Join(strings.Fields(title.String()), " "), nil
+			}
+		case html.TextToken:
+			if inTitle {
+				title.Write(z.Text())
+			}
+		}
+	}
+}
+
+// defaultDescription returns the title of the page the content points
+// to, or an empty string if it is not a web page or cannot be fetched.
+func defaultDescription(content string, timeout time.Duration) string {
+	if !isWebURL(content) {
+		return ""
+	}
+	title, err := fetchTitle(content, timeout)
+	if err != nil {
+		return ""
+	}
+	return title
+}
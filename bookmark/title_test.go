@@ -0,0 +1,68 @@
+package bookmark
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTitle(t *testing.T) {
+	tests := []struct {
+		html string
+		want string
+	}{
+		{"<html><head><title>Go</title></head></html>", "Go"},
+		{"<title>\n  The Go\n  Programming Language </title>", "The Go Programming Language"},
+		{"<title>Tom &amp; Jerry</title>", "Tom & Jerry"},
+		{"<html><body>no title</body></html>", ""},
+		{"", ""},
+	}
+	for _, test := range tests {
+		got, err := parseTitle(strings.NewReader(test.html))
+		if err != nil || got != test.want {
+			t.Errorf("parseTitle(%q) = %q, %v, want %q", test.html, got, err, test.want)
+		}
+	}
+}
+
+func TestFetchTitle(t *testing.T) {
+	// unblocked when the test ends, so the server can shut down
+	done := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><head><title>A page</title></head></html>")
+	})
+	mux.HandleFunc("/untitled", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html><body>nothing</body></html>")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	defer close(done)
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{"/page", "A page", false},
+		{"/untitled", "", false},
+		{"/missing", "", true},
+		{"/slow", "", true},
+	}
+	for _, test := range tests {
+		got, err := fetchTitle(srv.URL+test.path, 200*time.Millisecond)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("fetchTitle(%s) = %q, %v, want %q (error: %v)",
+				test.path, got, err, test.want, test.wantErr)
+		}
+	}
+	if got := defaultDescription(srv.URL+"/missing", time.Second); got != "" {
+		t.Errorf("defaultDescription of a missing page = %q, want empty", got)
+	}
+}
@@ -4,6 +4,7 @@ go 1.19
 
 require (
 	github.com/faiface/beep v1.1.0
+	github.com/godbus/dbus/v5 v5.1.0
 	github.com/magnickolas/stopit v0.0.0-20221229231747-106c167563ab
 	github.com/ncruces/zenity v0.10.5
 	github.com/pkg/errors v0.9.1
@@ -14,9 +15,10 @@ require (
 	github.com/rwxrob/help v0.7.2
 	github.com/rwxrob/pomo v0.2.3
 	github.com/rwxrob/vars v0.6.4
-	github.com/xellio/tools v0.0.0-20180807142225-794d9ef78e7d
 	golang.design/x/clipboard v0.6.3
+	golang.org/x/crypto v0.4.0
 	golang.org/x/exp v0.0.0-20221217163422-3c43f8badb15
+	golang.org/x/net v0.4.0
 	golang.org/x/term v0.3.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -54,11 +56,9 @@ require (
 	github.com/rwxrob/term v0.2.9 // indirect
 	github.com/rwxrob/to v0.12.1 // indirect
 	github.com/rwxrob/yq v0.3.2 // indirect
-	golang.org/x/crypto v0.4.0 // indirect
 	golang.org/x/exp/shiny v0.0.0-20221217163422-3c43f8badb15 // indirect
 	golang.org/x/image v0.2.0 // indirect
 	golang.org/x/mobile v0.0.0-20221110043201-43a038452099 // indirect
-	golang.org/x/net v0.4.0 // indirect
 	golang.org/x/sys v0.3.0 // indirect
 	golang.org/x/text v0.5.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
@@ -3,56 +3,180 @@
 package util
 
 import (
-	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	e "github.com/pkg/errors"
-	"github.com/xellio/tools/acpi"
 )
 
-type batteryLevel int
-type batteryStatus int
+const defaultPowerSupplyRoot = "/sys/class/power_supply"
 
-const (
-	Charging batteryStatus = iota
-	NotCharging
-	Discharging
-)
-
-func makeBatteryStatus(s string) (batteryStatus, error) {
+func makeBatteryStatus(s string) batteryStatus {
 	switch s {
 	case "Charging":
-		return Charging, nil
+		return Charging
 	case "Not charging":
-		return NotCharging, nil
+		return NotCharging
 	case "Discharging":
-		return Discharging, nil
+		return Discharging
+	case "Full":
+		return Full
 	default:
-		return 0, errors.New("unknown battery status")
+		return Unknown
 	}
 }
 
-type batteryInfo struct {
-	Status batteryStatus
-	Level  batteryLevel
+// powerSupply is a directory of the sysfs power_supply class.
+type powerSupply string
+
+func (p powerSupply) attr(name string) (string, bool) {
+	data, err := os.ReadFile(filepath.Join(string(p), name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(data)), true
 }
 
-func GetBatteryInfo() (batteryInfo, error) {
-	info, err := acpi.Battery()
+func (p powerSupply) intAttr(name string) (int64, bool) {
+	s, ok := p.attr(name)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n, err == nil
+}
+
+// microAttr reads an attribute given in millionths of its unit.
+func (p powerSupply) microAttr(name string) (float64, bool) {
+	n, ok := p.intAttr(name)
+	return float64(n) / 1e6, ok
+}
+
+// isSystemBattery reports whether the supply is a battery powering the
+// machine rather than a peripheral (scope "Device").
+func (p powerSupply) isSystemBattery() bool {
+	if t, _ := p.attr("type"); t != "Battery" {
+		return false
+	}
+	if scope, _ := p.attr("scope"); scope == "Device" {
+		return false
+	}
+	if present, ok := p.intAttr("present"); ok && present == 0 {
+		return false
+	}
+	return true
+}
+
+// energy returns the energy values in Wh, converting charge values
+// (Ah) with the design voltage for batteries that only report those.
+func (p powerSupply) energy(name string) (float64, bool) {
+	if energy, ok := p.microAttr("energy_" + name); ok {
+		return energy, true
+	}
+	charge, ok := p.microAttr("charge_" + name)
+	if !ok {
+		return 0, false
+	}
+	voltage, ok := p.microAttr("voltage_min_design")
+	if !ok {
+		voltage, ok = p.microAttr("voltage_now")
+	}
+	return charge * voltage, ok
+}
+
+func (p powerSupply) battery() batteryInfo {
+	var info batteryInfo
+	s, _ := p.attr("status")
+	info.Status = makeBatteryStatus(s)
+	info.EnergyNow, _ = p.energy("now")
+	info.EnergyFull, _ = p.energy("full")
+	if capacity, ok := p.intAttr("capacity"); ok {
+		info.Level = batteryLevel(capacity)
+	} else if info.EnergyFull > 0 {
+		info.Level = batteryLevel(math.Round(100 * info.EnergyNow / info.EnergyFull))
+	}
+	info.Voltage, _ = p.microAttr("voltage_now")
+	if power, ok := p.microAttr("power_now"); ok {
+		info.Power = math.Abs(power)
+	} else if current, ok := p.microAttr("current_now"); ok {
+		info.Power = math.Abs(current * info.Voltage)
+	}
+	if cycles, ok := p.intAttr("cycle_count"); ok {
+		info.CycleCount = int(cycles)
+	}
+	return info
+}
+
+// powerSupplies returns the supplies under the root sorted by name, so
+// BAT0 comes before BAT1.
+func powerSupplies(root string) ([]powerSupply, error) {
+	entries, err := os.ReadDir(root)
 	if err != nil {
-		return batteryInfo{}, e.Wrap(err, "get acpi battery info")
+		return nil, e.Wrap(err, "list power supplies")
+	}
+	var supplies []powerSupply
+	for _, entry := range entries {
+		supplies = append(supplies, powerSupply(filepath.Join(root, entry.Name())))
 	}
-	for _, b := range info {
-		if b.Level == 0 {
+	sort.Slice(supplies, func(i, j int) bool {
+		return supplies[i] < supplies[j]
+	})
+	return supplies, nil
+}
+
+// acOnline reports whether a mains or USB power supply is plugged in.
+func acOnline(supplies []powerSupply) bool {
+	for _, p := range supplies {
+		t, _ := p.attr("type")
+		if t != "Mains" && !strings.HasPrefix(t, "USB") {
 			continue
 		}
-		status, err := makeBatteryStatus(b.Status)
-		if err != nil {
-			return batteryInfo{}, e.Wrap(err, "parse battery status")
+		if online, ok := p.intAttr("online"); ok && online == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// readBatteries reads the batteries with the backend of the options.
+func readBatteries(opts BatteryOptions) ([]batteryInfo, error) {
+	switch opts.Backend {
+	case "", SysfsBackend:
+		return readSysfsBatteries(opts)
+	case UPowerBackend:
+		return readUPowerBatteries(opts)
+	default:
+		return nil, e.Errorf("unknown battery backend %s", opts.Backend)
+	}
+}
+
+// readSysfsBatteries reads the batteries of the sysfs power_supply class.
+func readSysfsBatteries(opts BatteryOptions) ([]batteryInfo, error) {
+	root := opts.PowerSupplyRoot
+	if root == "" {
+		root = defaultPowerSupplyRoot
+	}
+	supplies, err := powerSupplies(root)
+	if err != nil {
+		return nil, err
+	}
+	ac := acOnline(supplies)
+	var batteries []batteryInfo
+	for _, p := range supplies {
+		if !p.isSystemBattery() {
+			continue
 		}
-		return batteryInfo{
-			Status: status,
-			Level:  batteryLevel(b.Level),
-		}, nil
+		info := p.battery()
+		info.Name = filepath.Base(string(p))
+		info.ACOnline = ac
+		batteries = append(batteries, info)
+	}
+	if len(batteries) == 0 {
+		return nil, e.Errorf("no battery found in %s", root)
 	}
-	return batteryInfo{}, nil
+	return batteries, nil
 }
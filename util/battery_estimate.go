@@ -0,0 +1,153 @@
+package util
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"os"
+	"time"
+
+	e "github.com/pkg/errors"
+)
+
+const (
+	// sampleInterval is the minimum time between two recorded samples,
+	// so frequent callers like status bars do not fill the window.
+	sampleInterval = 30 * time.Second
+	// sampleWindow is how far back samples are averaged over.
+	sampleWindow = 20 * time.Minute
+	// minSampleSpan is how long samples must span before the rate they
+	// give is trusted.
+	minSampleSpan = 2 * time.Minute
+)
+
+type chargeSample struct {
+	Time   int64   `json:"time"`
+	Charge float64 `json:"charge"`
+}
+
+// batteryState is what the state file keeps for a battery: the charge
+// samples since it entered its current status.
+type batteryState struct {
+	Status  batteryStatus  `json:"status"`
+	Samples []chargeSample `json:"samples"`
+}
+
+// charge returns the charge in percent, more precise than Level when the
+// energy is known.
+func (b batteryInfo) charge() float64 {
+	if b.EnergyFull > 0 {
+		return 100 * b.EnergyNow / b.EnergyFull
+	}
+	return float64(b.Level)
+}
+
+// remainingFromPower estimates the remaining time from the energy and
+// the power the battery reports.
+func remainingFromPower(b batteryInfo) time.Duration {
+	if b.Power <= 0 {
+		return 0
+	}
+	var energy float64
+	switch b.Status {
+	case Discharging:
+		energy = b.EnergyNow
+	case Charging:
+		energy = b.EnergyFull - b.EnergyNow
+	}
+	if energy <= 0 {
+		return 0
+	}
+	return time.Duration(energy / b.Power * float64(time.Hour))
+}
+
+// add records the charge of the battery, starting over when its status
+// changed or the charge went the wrong way (e.g. when the charger was
+// briefly plugged in), and forgets the samples out of the window.
+func (s *batteryState) add(b batteryInfo, now time.Time) {
+	if s.Status != b.Status {
+		*s = batteryState{Status: b.Status}
+	}
+	charge := b.charge()
+	if n := len(s.Samples); n > 0 {
+		last := s.Samples[n-1]
+		if (b.Status == Discharging && charge > last.Charge) ||
+			(b.Status == Charging && charge < last.Charge) {
+			s.Samples = nil
+		} else if now.Sub(time.Unix(last.Time, 0)) < sampleInterval {
+			return
+		}
+	}
+	for len(s.Samples) > 0 && now.Sub(time.Unix(s.Samples[0].Time, 0)) > sampleWindow {
+		s.Samples = s.Samples[1:]
+	}
+	s.Samples = append(s.Samples, chargeSample{Time: now.Unix(), Charge: charge})
+}
+
+// remaining estimates the remaining time from the average rate of
+// change of the charge over the samples.
+func (s batteryState) remaining(b batteryInfo, now time.Time) time.Duration {
+	if len(s.Samples) == 0 {
+		return 0
+	}
+	first := s.Samples[0]
+	span := now.Sub(time.Unix(first.Time, 0))
+	charge := b.charge()
+	delta := math.Abs(charge - first.Charge)
+	if span < minSampleSpan || delta == 0 {
+		return 0
+	}
+	left := charge
+	if b.Status == Charging {
+		left = 100 - charge
+	}
+	return time.Duration(left / delta * float64(span))
+}
+
+// estimateRemaining sets the remaining time of the batteries not
+// reporting it, from their power or otherwise from the samples of the
+// state file, which is updated.
+func estimateRemaining(info *batteriesInfo, stateFile string, now time.Time) error {
+	old := map[string]batteryState{}
+	var data []byte
+	if stateFile != "" {
+		var err error
+		data, err = os.ReadFile(stateFile)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return e.Wrap(err, "read battery state")
+		}
+		// a corrupted state file only loses the samples
+		json.Unmarshal(data, &old)
+	}
+	states := map[string]batteryState{}
+	estimate := func(b *batteryInfo) {
+		if b.Remaining == 0 {
+			b.Remaining = remainingFromPower(*b)
+		}
+		if b.Status != Charging && b.Status != Discharging {
+			return
+		}
+		s := old[b.Name]
+		s.add(*b, now)
+		if b.Remaining == 0 {
+			b.Remaining = s.remaining(*b, now)
+		}
+		states[b.Name] = s
+	}
+	for i := range info.Batteries {
+		estimate(&info.Batteries[i])
+	}
+	estimate(&info.Combined)
+	if stateFile == "" {
+		return nil
+	}
+	newData, err := json.Marshal(states)
+	if err != nil {
+		return e.Wrap(err, "encode battery state")
+	}
+	if bytes.Equal(newData, data) {
+		return nil
+	}
+	return e.Wrap(WriteFileAtomic(stateFile, newData, 0644), "write battery state")
+}
@@ -0,0 +1,168 @@
+package util
+
+import (
+	"math"
+	"time"
+
+	e "github.com/pkg/errors"
+	"golang.org/x/exp/slices"
+)
+
+type batteryLevel int
+type batteryStatus int
+
+const (
+	Charging batteryStatus = iota
+	NotCharging
+	Discharging
+	Full
+	Unknown
+)
+
+// combinedStatusOrder ranks the statuses for combining batteries: the
+// combination has the first status any of them has, so it is only Full
+// when all of them are.
+var combinedStatusOrder = []batteryStatus{Charging, Discharging, NotCharging, Unknown, Full}
+
+// Backends reading battery information on Linux.
+const (
+	SysfsBackend  = "sysfs"
+	UPowerBackend = "upower"
+)
+
+// BatteryOptions configure where battery information is read from.
+type BatteryOptions struct {
+	// Backend is SysfsBackend (the default) or UPowerBackend, which also
+	// reports peripherals; Linux only.
+	Backend string
+	// UPowerBus is the D-Bus bus UPower is reached on, "system" (the
+	// default), "session" or a bus address like unix:path=/run/bus.
+	UPowerBus string
+	// PowerSupplyRoot is the sysfs power_supply class directory (Linux
+	// only), /sys/class/power_supply if empty.
+	PowerSupplyRoot string
+	// Battery is the name of the battery (e.g. BAT1) GetBatteryInfo
+	// returns, or CombinedBattery (or empty) for all of them combined.
+	Battery string
+	// StateFile keeps recent samples of the charge, to estimate the
+	// remaining time of batteries that do not report their power. No
+	// samples are kept if empty.
+	StateFile string
+}
+
+// CombinedBattery names the combination of all batteries.
+const CombinedBattery = "combined"
+
+// batteryInfo describes a battery; the fields besides Status and Level
+// are zero when the platform does not report them. Energy is in Wh,
+// power in W and voltage in V. ACOnline tells whether the machine is
+// plugged in, which a Full or NotCharging status does not imply.
+// Remaining is the estimated time to empty when discharging and to full
+// when charging, zero when unknown. Peripherals, like wireless mice, do
+// not power the machine and are left out of the combination.
+type batteryInfo struct {
+	Name       string
+	Model      string
+	Peripheral bool
+	Status     batteryStatus
+	Level      batteryLevel
+	EnergyNow  float64
+	EnergyFull float64
+	Power      float64
+	Voltage    float64
+	CycleCount int
+	ACOnline   bool
+	Remaining  time.Duration
+}
+
+// batteriesInfo describes every battery of the machine and their
+// combination.
+type batteriesInfo struct {
+	Batteries []batteryInfo
+	Combined  batteryInfo
+}
+
+// combineBatteries computes the combined state of the batteries but
+// the peripherals: the level is the one of their total energy, so a
+// nearly empty small battery weighs less than a large one. If some
+// battery does not report its energy, the levels are averaged instead.
+func combineBatteries(all []batteryInfo) batteryInfo {
+	combined := batteryInfo{Name: CombinedBattery, Status: Unknown}
+	rank := len(combinedStatusOrder)
+	byEnergy := true
+	levels := 0
+	var batteries []batteryInfo
+	for _, b := range all {
+		if !b.Peripheral {
+			batteries = append(batteries, b)
+		}
+	}
+	for _, b := range batteries {
+		combined.EnergyNow += b.EnergyNow
+		combined.EnergyFull += b.EnergyFull
+		combined.ACOnline = combined.ACOnline || b.ACOnline
+		byEnergy = byEnergy && b.EnergyFull > 0
+		levels += int(b.Level)
+		if r := slices.Index(combinedStatusOrder, b.Status); r >= 0 && r < rank {
+			rank = r
+			combined.Status = b.Status
+		}
+	}
+	if len(batteries) == 0 {
+		return combined
+	}
+	// the power of batteries idle or charging while the others discharge
+	// does not count towards the discharge rate
+	for _, b := range batteries {
+		if b.Status == combined.Status {
+			combined.Power += b.Power
+		}
+	}
+	if byEnergy {
+		combined.Level = batteryLevel(math.Round(100 * combined.EnergyNow / combined.EnergyFull))
+	} else {
+		combined.Level = batteryLevel(math.Round(float64(levels) / float64(len(batteries))))
+	}
+	return combined
+}
+
+// Select returns the battery with the given name, or the combined one
+// for CombinedBattery or an empty name.
+func (b batteriesInfo) Select(name string) (batteryInfo, error) {
+	if name == "" || name == CombinedBattery {
+		return b.Combined, nil
+	}
+	for _, info := range b.Batteries {
+		if info.Name == name {
+			return info, nil
+		}
+	}
+	return batteryInfo{}, e.Errorf("no battery named %s", name)
+}
+
+// GetBatteries reads the batteries, combines them and estimates their
+// remaining time.
+func GetBatteries(opts BatteryOptions) (batteriesInfo, error) {
+	batteries, err := readBatteries(opts)
+	if err != nil {
+		return batteriesInfo{}, err
+	}
+	info := batteriesInfo{
+		Batteries: batteries,
+		Combined:  combineBatteries(batteries),
+	}
+	err = estimateRemaining(&info, opts.StateFile, time.Now())
+	if err != nil {
+		return batteriesInfo{}, err
+	}
+	return info, nil
+}
+
+// GetBatteryInfo returns the battery chosen by opts.Battery.
+func GetBatteryInfo(opts BatteryOptions) (batteryInfo, error) {
+	batteries, err := GetBatteries(opts)
+	if err != nil {
+		return batteryInfo{}, err
+	}
+	return batteries.Select(opts.Battery)
+}
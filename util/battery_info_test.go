@@ -0,0 +1,44 @@
+package util
+
+import "testing"
+
+func TestCombineBatteries(t *testing.T) {
+	tests := []struct {
+		name      string
+		batteries []batteryInfo
+		status    batteryStatus
+		level     batteryLevel
+		power     float64
+	}{
+		{"none", nil, Unknown, 0, 0},
+		// weighted by energy rather than averaged (which would be 50%)
+		{"by energy", []batteryInfo{
+			{Status: Discharging, Level: 10, EnergyNow: 2, EnergyFull: 20, Power: 8},
+			{Status: NotCharging, Level: 90, EnergyNow: 54, EnergyFull: 60},
+		}, Discharging, 70, 8},
+		{"by level", []batteryInfo{
+			{Status: Full, Level: 100},
+			{Status: Charging, Level: 50, Power: 20},
+		}, Charging, 75, 20},
+		{"all full", []batteryInfo{
+			{Status: Full, Level: 100, EnergyNow: 50, EnergyFull: 50},
+			{Status: Full, Level: 100, EnergyNow: 20, EnergyFull: 20},
+		}, Full, 100, 0},
+		{"full and unknown", []batteryInfo{
+			{Status: Full, Level: 100},
+			{Status: Unknown, Level: 80},
+		}, Unknown, 90, 0},
+		{"peripherals left out", []batteryInfo{
+			{Status: Charging, Level: 60, EnergyNow: 30, EnergyFull: 50, Power: 5},
+			{Status: Discharging, Level: 5, Peripheral: true},
+		}, Charging, 60, 5},
+	}
+	for _, test := range tests {
+		got := combineBatteries(test.batteries)
+		if got.Name != CombinedBattery || got.Status != test.status ||
+			got.Level != test.level || got.Power != test.power {
+			t.Errorf("%s: combineBatteries() = %+v, want status %d, level %d, power %g",
+				test.name, got, test.status, test.level, test.power)
+		}
+	}
+}
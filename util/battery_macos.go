@@ -3,58 +3,59 @@
 package util
 
 import (
-	"errors"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	e "github.com/pkg/errors"
 )
 
-type batteryLevel int
-type batteryStatus int
-
-const (
-	Charging batteryStatus = iota
-	NotCharging
-	Discharging
-)
-
-func makeBatteryStatus(s string) (batteryStatus, error) {
+func makeBatteryStatus(s string) batteryStatus {
 	switch s {
-	case "charging":
-		return Charging, nil
+	case "charging", "finishing":
+		return Charging
 	case "discharging":
-		return Discharging, nil
-	case "AC", "charged":
-		return NotCharging, nil
+		return Discharging
+	case "AC":
+		return NotCharging
+	case "charged":
+		return Full
 	default:
-		return 0, errors.New("unknown battery status")
+		return Unknown
 	}
 }
 
-type batteryInfo struct {
-	Status batteryStatus
-	Level  batteryLevel
-}
+var pmsetRemaining = regexp.MustCompile(`(\d+):(\d+) remaining`)
 
-func GetBatteryInfo() (batteryInfo, error) {
+// readBatteries reads the internal battery, which is the only one pmset
+// reports.
+func readBatteries(_ BatteryOptions) ([]batteryInfo, error) {
 	cmd := exec.Command("pmset", "-g", "batt")
 	out, err := cmd.Output()
 	if err != nil {
-		return batteryInfo{}, e.Wrap(err, "get battery info")
+		return nil, e.Wrap(err, "get battery info")
 	}
-	line := strings.Split(string(out), "\n")[1]
-	fields := strings.FieldsFunc(line, Split)
+	lines := strings.Split(string(out), "\n")
+	fields := strings.FieldsFunc(lines[1], Split)
 	level, err := strconv.Atoi(fields[2])
 	if err != nil {
-		return batteryInfo{}, e.Wrap(err, "cannot parse battery level")
+		return nil, e.Wrap(err, "cannot parse battery level")
 	}
-	status, err := makeBatteryStatus(fields[3])
-	if err != nil {
-		return batteryInfo{}, e.Wrap(err, "unknown battery status")
+	info := batteryInfo{
+		Name:     "InternalBattery",
+		Status:   makeBatteryStatus(fields[3]),
+		Level:    batteryLevel(level),
+		ACOnline: strings.Contains(lines[0], "'AC Power'"),
+	}
+	// pmset estimates the time to empty or to full itself
+	if m := pmsetRemaining.FindStringSubmatch(lines[1]); m != nil {
+		hours, _ := strconv.Atoi(m[1])
+		minutes, _ := strconv.Atoi(m[2])
+		info.Remaining = time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute
 	}
-	return batteryInfo{status, batteryLevel(level)}, nil
+	return []batteryInfo{info}, nil
 }
 
 func Split(r rune) bool {
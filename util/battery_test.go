@@ -0,0 +1,69 @@
+//go:build linux
+
+package util
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadSysfsBatteries(t *testing.T) {
+	tests := []struct {
+		root    string
+		want    []batteryInfo
+		wantErr bool
+	}{
+		{"energy", []batteryInfo{
+			{Name: "BAT0", Status: Discharging, Level: 40, EnergyNow: 20, EnergyFull: 50,
+				Power: 10, Voltage: 12, CycleCount: 150},
+			// no capacity, the level comes from the energy
+			{Name: "BAT1", Status: Unknown, Level: 90, EnergyNow: 18, EnergyFull: 20},
+		}, false},
+		// charge in Ah converted with the design voltage, power from the
+		// current; the absent battery and the peripheral are skipped
+		{"charge", []batteryInfo{
+			{Name: "BAT0", Status: Charging, Level: 50, EnergyNow: 22, EnergyFull: 44,
+				Power: 18, Voltage: 12, ACOnline: true},
+		}, false},
+		{"full", []batteryInfo{
+			{Name: "BAT0", Status: Full, Level: 100, ACOnline: true},
+		}, false},
+		{"nobattery", nil, true},
+		{"missing", nil, true},
+	}
+	for _, test := range tests {
+		root := filepath.Join("testdata", "power_supply", test.root)
+		got, err := readSysfsBatteries(BatteryOptions{PowerSupplyRoot: root})
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: error %v, want error: %v", test.root, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: readSysfsBatteries() =\n%+v\nwant\n%+v", test.root, got, test.want)
+		}
+	}
+}
+
+func TestGetBatteriesSysfs(t *testing.T) {
+	root := filepath.Join("testdata", "power_supply", "energy")
+	batteries, err := GetBatteries(BatteryOptions{PowerSupplyRoot: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	combined := batteries.Combined
+	// 38 of 70 Wh, drained by BAT0 alone
+	if combined.Status != Discharging || combined.Level != 54 || combined.Power != 10 {
+		t.Errorf("combined = %+v, want 54%% discharging at 10 W", combined)
+	}
+	if got := FormatRemaining(combined.Remaining); got != "3 h 48 min" {
+		t.Errorf("combined remaining = %s, want 3 h 48 min", got)
+	}
+	info, err := GetBatteryInfo(BatteryOptions{PowerSupplyRoot: root, Battery: "BAT1"})
+	if err != nil || info.Name != "BAT1" {
+		t.Errorf("GetBatteryInfo(BAT1) = %+v, %v", info, err)
+	}
+	if _, err := GetBatteryInfo(BatteryOptions{PowerSupplyRoot: root, Battery: "BAT2"}); err == nil {
+		t.Error("GetBatteryInfo(BAT2) succeeded, want an error")
+	}
+}
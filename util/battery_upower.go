@@ -0,0 +1,128 @@
+//go:build linux
+
+package util
+
+import (
+	"math"
+	"path"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	e "github.com/pkg/errors"
+)
+
+const (
+	upowerService = "org.freedesktop.UPower"
+	upowerPath    = "/org/freedesktop/UPower"
+	upowerDevice  = "org.freedesktop.UPower.Device"
+)
+
+// UPower device types that are not batteries.
+const (
+	upowerTypeUnknown   = 0
+	upowerTypeLinePower = 1
+)
+
+// upowerStates maps the UPower device states, from Unknown to
+// PendingDischarge, to battery statuses.
+var upowerStates = []batteryStatus{
+	Unknown, Charging, Discharging, Discharging, Full, NotCharging, NotCharging,
+}
+
+// upowerDeviceProps are the properties of an UPower device.
+type upowerDeviceProps map[string]dbus.Variant
+
+// upowerProp returns the value of a property, the zero value if the
+// device does not have it.
+func upowerProp[T any](p upowerDeviceProps, name string) T {
+	v, _ := p[name].Value().(T)
+	return v
+}
+
+// upowerConn connects to the bus UPower is reached on: "system" (the
+// default), "session" or the address of another bus.
+func upowerConn(bus string) (*dbus.Conn, error) {
+	switch bus {
+	case "", "system":
+		return dbus.ConnectSystemBus()
+	case "session":
+		return dbus.ConnectSessionBus()
+	default:
+		return dbus.Connect(bus)
+	}
+}
+
+// battery converts the properties of a device; the batteries that do
+// not supply the machine are peripherals.
+func (p upowerDeviceProps) battery(device dbus.ObjectPath) batteryInfo {
+	info := batteryInfo{
+		Name:       path.Base(upowerProp[string](p, "NativePath")),
+		Model:      upowerProp[string](p, "Model"),
+		Peripheral: !upowerProp[bool](p, "PowerSupply"),
+		Status:     Unknown,
+		Level:      batteryLevel(math.Round(upowerProp[float64](p, "Percentage"))),
+		EnergyNow:  upowerProp[float64](p, "Energy"),
+		EnergyFull: upowerProp[float64](p, "EnergyFull"),
+		Power:      upowerProp[float64](p, "EnergyRate"),
+		Voltage:    upowerProp[float64](p, "Voltage"),
+		CycleCount: int(upowerProp[int32](p, "ChargeCycles")),
+	}
+	if upowerProp[string](p, "NativePath") == "" {
+		info.Name = path.Base(string(device))
+	}
+	if state := upowerProp[uint32](p, "State"); int(state) < len(upowerStates) {
+		info.Status = upowerStates[state]
+	}
+	switch info.Status {
+	case Discharging:
+		info.Remaining = time.Duration(upowerProp[int64](p, "TimeToEmpty")) * time.Second
+	case Charging:
+		info.Remaining = time.Duration(upowerProp[int64](p, "TimeToFull")) * time.Second
+	}
+	return info
+}
+
+// readUPowerBatteries reads the batteries, including the peripheral
+// ones, UPower knows about.
+func readUPowerBatteries(opts BatteryOptions) ([]batteryInfo, error) {
+	conn, err := upowerConn(opts.UPowerBus)
+	if err != nil {
+		return nil, e.Wrap(err, "connect to D-Bus")
+	}
+	defer conn.Close()
+	upower := conn.Object(upowerService, upowerPath)
+	var devices []dbus.ObjectPath
+	err = upower.Call(upowerService+".EnumerateDevices", 0).Store(&devices)
+	if err != nil {
+		return nil, e.Wrap(err, "enumerate UPower devices")
+	}
+	var onBattery bool
+	v, err := upower.GetProperty(upowerService + ".OnBattery")
+	if err == nil {
+		err = v.Store(&onBattery)
+	}
+	if err != nil {
+		return nil, e.Wrap(err, "get UPower OnBattery")
+	}
+	var batteries []batteryInfo
+	for _, device := range devices {
+		var p upowerDeviceProps
+		err = conn.Object(upowerService, device).
+			Call("org.freedesktop.DBus.Properties.GetAll", 0, upowerDevice).Store(&p)
+		if err != nil {
+			return nil, e.Wrapf(err, "get properties of %s", device)
+		}
+		deviceType := upowerProp[uint32](p, "Type")
+		if deviceType == upowerTypeUnknown || deviceType == upowerTypeLinePower ||
+			(upowerProp[bool](p, "PowerSupply") && !upowerProp[bool](p, "IsPresent")) {
+			continue
+		}
+		info := p.battery(device)
+		info.ACOnline = !onBattery
+		batteries = append(batteries, info)
+	}
+	if len(batteries) == 0 {
+		return nil, e.New("no battery found by UPower")
+	}
+	return batteries, nil
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package util
+
+import (
+	"bufio"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/godbus/dbus/v5/prop"
+)
+
+// mockUPower is the root object of the mock UPower service.
+type mockUPower struct {
+	devices []dbus.ObjectPath
+}
+
+func (m mockUPower) EnumerateDevices() ([]dbus.ObjectPath, *dbus.Error) {
+	return m.devices, nil
+}
+
+// startBus runs a private dbus-daemon and returns its address.
+func startBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon is not installed")
+	}
+	address := "unix:path=" + filepath.Join(t.TempDir(), "bus")
+	cmd := exec.Command("dbus-daemon", "--session", "--nofork", "--nopidfile",
+		"--address="+address, "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	// the address is printed once the bus accepts connections
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("read bus address: %v", err)
+	}
+	return strings.TrimSpace(line)
+}
+
+// exportMockUPower serves UPower on the bus with the given devices.
+func exportMockUPower(t *testing.T, address string, onBattery bool, devices map[dbus.ObjectPath]map[string]any) {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	var paths []dbus.ObjectPath
+	for path, props := range devices {
+		paths = append(paths, path)
+		m := map[string]*prop.Prop{}
+		for name, value := range props {
+			m[name] = &prop.Prop{Value: value, Emit: prop.EmitFalse}
+		}
+		if _, err := prop.Export(conn, path, prop.Map{upowerDevice: m}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// enumerated in a fixed order
+	sort.Slice(paths, func(i, j int) bool { return paths[i] < paths[j] })
+	if err := conn.Export(mockUPower{paths}, upowerPath, upowerService); err != nil {
+		t.Fatal(err)
+	}
+	_, err = prop.Export(conn, upowerPath, prop.Map{upowerService: {
+		"OnBattery": {Value: onBattery, Emit: prop.EmitFalse},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reply, err := conn.RequestName(upowerService, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request name: %v (reply %d)", err, reply)
+	}
+}
+
+func TestReadUPowerBatteries(t *testing.T) {
+	address := startBus(t)
+	exportMockUPower(t, address, true, map[dbus.ObjectPath]map[string]any{
+		"/org/freedesktop/UPower/devices/line_power_AC": {
+			"Type": uint32(1), "PowerSupply": true, "Online": false, "NativePath": "AC",
+		},
+		"/org/freedesktop/UPower/devices/battery_BAT0": {
+			"Type": uint32(2), "PowerSupply": true, "IsPresent": true, "State": uint32(2),
+			"Percentage": 41.6, "Energy": 20.8, "EnergyFull": 50.0, "EnergyRate": 10.4,
+			"Voltage": 11.9, "TimeToEmpty": int64(7200), "TimeToFull": int64(0),
+			"ChargeCycles": int32(120), "NativePath": "BAT0", "Model": "5B10W13930",
+		},
+		"/org/freedesktop/UPower/devices/battery_BAT1": {
+			"Type": uint32(2), "PowerSupply": true, "IsPresent": false, "NativePath": "BAT1",
+		},
+		"/org/freedesktop/UPower/devices/mouse_hidpp_battery_0": {
+			"Type": uint32(5), "PowerSupply": false, "IsPresent": true, "State": uint32(2),
+			"Percentage": 55.0, "NativePath": "hidpp_battery_0", "Model": "MX Master 3",
+		},
+		// no native path, named after the object
+		"/org/freedesktop/UPower/devices/headset_dev_AA": {
+			"Type": uint32(17), "PowerSupply": false, "IsPresent": true, "State": uint32(4),
+			"Percentage": 100.0, "Model": "WH-1000XM4",
+		},
+	})
+
+	got, err := readUPowerBatteries(BatteryOptions{UPowerBus: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []batteryInfo{
+		{Name: "BAT0", Model: "5B10W13930", Status: Discharging, Level: 42, EnergyNow: 20.8,
+			EnergyFull: 50, Power: 10.4, Voltage: 11.9, CycleCount: 120, Remaining: 2 * time.Hour},
+		{Name: "headset_dev_AA", Model: "WH-1000XM4", Peripheral: true, Status: Full, Level: 100},
+		{Name: "hidpp_battery_0", Model: "MX Master 3", Peripheral: true, Status: Discharging, Level: 55},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readUPowerBatteries() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	batteries, err := GetBatteries(BatteryOptions{Backend: UPowerBackend, UPowerBus: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the peripherals are left out of the combination
+	if c := batteries.Combined; c.Level != 42 || c.Status != Discharging || c.Remaining != 2*time.Hour {
+		t.Errorf("combined = %+v, want BAT0's level, status and remaining time", c)
+	}
+}
+
+func TestReadUPowerBatteriesNoService(t *testing.T) {
+	address := startBus(t)
+	if _, err := readUPowerBatteries(BatteryOptions{UPowerBus: address}); err == nil {
+		t.Error("readUPowerBatteries() succeeded without UPower on the bus")
+	}
+}
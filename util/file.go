@@ -0,0 +1,46 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	e "github.com/pkg/errors"
+)
+
+// WriteFileAtomic writes data to a temporary file in the same directory
+// and renames it over path, so readers see either the old or the new
+// content but never a partially written file. The permissions of an
+// existing file are kept, perm is used otherwise. A symlink is followed
+// so that its target is replaced rather than the link itself.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return e.Wrap(err, "resolve symlinks")
+	}
+	if stat, err := os.Stat(path); err == nil {
+		perm = stat.Mode().Perm()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return e.Wrap(err, "stat file")
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return e.Wrap(err, "create temp file")
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err = f.Write(data); err != nil {
+		return e.Wrap(err, "write temp file")
+	}
+	if err = f.Chmod(perm); err != nil {
+		return e.Wrap(err, "chmod temp file")
+	}
+	if err = f.Sync(); err != nil {
+		return e.Wrap(err, "sync temp file")
+	}
+	if err = f.Close(); err != nil {
+		return e.Wrap(err, "close temp file")
+	}
+	return e.Wrap(os.Rename(f.Name(), path), "rename temp file")
+}
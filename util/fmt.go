@@ -3,6 +3,7 @@ package util
 import (
 	"fmt"
 	"regexp"
+	"time"
 )
 
 var re = regexp.MustCompile(`{(.+?)}`)
@@ -19,3 +20,16 @@ func Fprint(format string, argsNamed map[string]any) string {
 		return s
 	})
 }
+
+// FormatRemaining formats an estimated duration to the minute, e.g.
+// "22 min" or "1 h 05 min", and an unknown (zero) one as "".
+func FormatRemaining(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	minutes := Max(int(d.Round(time.Minute).Minutes()), 1)
+	if minutes < 60 {
+		return fmt.Sprintf("%d min", minutes)
+	}
+	return fmt.Sprintf("%d h %02d min", minutes/60, minutes%60)
+}